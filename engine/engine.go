@@ -4,8 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"math"
 	"strconv"
 	"strings"
 
@@ -27,11 +26,71 @@ type Engine struct {
 	// Execute and remember stuff here
 	cache        map[string]interface{}
 	formulaCache map[string]*f1F.Formula
+	// Sheet qualified areas of the ranges in cache, by cache key
+	cachedRanges map[string]f1F.Reference
+	// Defined names and the formula text they stand for, see nameKey
+	names map[string]string
+	// Dependencies between cells, see dependencyGraph
+	graph *graph
+	// Failures of the formula given to EvalFormula, see LastErrors
+	nodeErrors []*NodeError
+	// Number of EvalFormula calls under way, formulas of the cells read run
+	// nested in the outermost one
+	depth int
+	// Diagnostics go here, see WithLogger
+	logger Logger
+}
+
+// operators Infix and prefix operators evaluated by runStack
+var operators = map[string]bool{
+	"IDENTITY": true,
+	"+":        true,
+	"-":        true,
+	"*":        true,
+	"/":        true,
+	"^":        true,
+	"%":        true,
+	"&":        true,
+	"=":        true,
+	"<>":       true,
+	"<":        true,
+	">":        true,
+	"<=":       true,
+	">=":       true,
+}
+
+// arithmetics Operators yielding a number from numeric operands
+var arithmetics = map[string]bool{
+	"+": true,
+	"-": true,
+	"*": true,
+	"/": true,
+	"^": true,
+	"%": true,
+}
+
+// comparisons Operators yielding a boolean from two operands
+var comparisons = map[string]bool{
+	"=":  true,
+	"<>": true,
+	"<":  true,
+	">":  true,
+	"<=": true,
+	">=": true,
+}
+
+// rangeOperators Operators combining references rather than values
+var rangeOperators = map[string]bool{
+	":": true,
+	" ": true,
+	",": true,
 }
 
 type Invoke struct {
 	fn    string
 	arity int
+	// span Location of the calling node in the formula text
+	span f1F.Span
 }
 
 type Cell struct {
@@ -52,12 +111,6 @@ type OutParam struct {
 	Value  interface{}
 }
 
-var logger *log.Logger
-
-func init() {
-	logger = log.New(os.Stdout, "ENGINE ", log.Lshortfile)
-}
-
 // ToSlice Get a copy of the 1D Range
 func (cellRange *Range) ToSlice() (cells []Cell, ok bool) {
 	if cellRange.colCount == 1 && cellRange.rowCount > 1 {
@@ -90,13 +143,78 @@ func (cellRange *Range) To2DSlice() (cells [][]Cell, ok bool) {
 }
 
 // NewEngine Create a new g to execute formula suitable for xlFile
-func NewEngine(xlFile *xlsx.File) *Engine {
-	return &Engine{
+func NewEngine(xlFile *xlsx.File, options ...Option) *Engine {
+	engine := &Engine{
 		cache:        make(map[string]interface{}),
 		formulaCache: make(map[string]*f1F.Formula),
+		cachedRanges: make(map[string]f1F.Reference),
+		names:        make(map[string]string),
 		xlFile:       xlFile,
 		callstack:    stack.New(),
+		logger:       nopLogger{},
+	}
+	for _, option := range options {
+		option(engine)
+	}
+	if xlFile == nil {
+		// Enough for formulas of constants
+		return engine
+	}
+
+	for _, definedName := range xlFile.DefinedNames {
+		// The workbook reader cannot tell a name scoped to the first sheet
+		// from a workbook wide one, both come with LocalSheetID 0
+		sheet := ""
+		if definedName.LocalSheetID > 0 && definedName.LocalSheetID < len(xlFile.Sheets) {
+			sheet = xlFile.Sheets[definedName.LocalSheetID].Name
+		}
+		engine.DefineName(definedName.Name, definedName.Data, sheet)
+	}
+	return engine
+}
+
+// DefineName Add a defined name standing for refersTo, e.g. Input!$B$2 or
+// 0.05. The name is visible workbook wide when sheet is empty
+func (g *Engine) DefineName(name string, refersTo string, sheet string) {
+	g.names[nameKey(sheet, name)] = strings.TrimPrefix(refersTo, "=")
+	g.graph = nil
+	// Cached values may have been computed with what the name stood for before
+	g.cache = make(map[string]interface{})
+	g.cachedRanges = make(map[string]f1F.Reference)
+}
+
+// nameKey Lookup key of a name, names are case insensitive like in Excel
+func nameKey(sheet string, name string) string {
+	return strings.ToUpper(sheet + "!" + name)
+}
+
+// resolveName Formula text a defined name stands for. Sheet scoped names of
+// the active sheet hide workbook names of the same spelling
+func (g *Engine) resolveName(text string) (refersTo string, ok bool) {
+	qualifier, activeSheet := "", ""
+	if index := strings.LastIndex(text, "!"); index >= 0 {
+		qualifier = strings.Replace(strings.Trim(text[:index], "'"), "''", "'", -1)
+		text = text[index+1:]
+	}
+	if sheet := g.sheet(f1F.Reference{}); sheet != nil {
+		activeSheet = sheet.Name
 	}
+
+	_, refersTo, ok = g.lookupName(qualifier, activeSheet, text)
+	return
+}
+
+// reference Parse an address, or the address of a defined name
+func (g *Engine) reference(text string) (ref f1F.Reference, err error) {
+	if ref, err = f1F.ParseReference(text); err == nil {
+		return
+	}
+	if refersTo, ok := g.resolveName(text); ok {
+		if ref, err = f1F.ParseReference(refersTo); err != nil {
+			err = fmt.Errorf("Name %s does not refer to cells", text)
+		}
+	}
+	return
 }
 
 func NewOutParam(format string) OutParam {
@@ -112,42 +230,33 @@ func (g *Engine) GetRange(rangeIDString string) (cellRange Range, err error) {
 		return
 	}
 
-	var sheet *xlsx.Sheet
-	var fromIDString, toIDString string
-
-	if strings.Contains(rangeIDString, "!") {
-		splat := strings.Split(rangeIDString, "!")
-		sheet = g.xlFile.Sheet[splat[0]]
-		g.activeSheet = sheet
-		rangeIDString = splat[1]
-	} else if g.activeSheet != nil {
-		sheet = g.activeSheet
-	} else {
-		sheet = g.xlFile.Sheets[0]
+	var ref f1F.Reference
+	if ref, err = g.reference(rangeIDString); err != nil {
+		return
 	}
 
-	var colFrom, rowFrom, colTo, rowTo int
-	var xlError error
-	if strings.Contains(rangeIDString, ":") {
-		splat := strings.Split(rangeIDString, ":")
-		fromIDString = splat[0]
-		toIDString = splat[1]
-	} else {
-		fromIDString = rangeIDString
-		toIDString = rangeIDString
-	}
+	return g.getRange(ref)
+}
 
-	if colFrom, rowFrom, xlError = xlsx.GetCoordsFromCellIDString(fromIDString); xlError != nil {
-		err = xlError
+func (g *Engine) getRange(ref f1F.Reference) (cellRange Range, err error) {
+	sheet := g.sheet(ref)
+	if sheet == nil {
+		err = funs.ErrRef
 		return
+	} else if ref.Sheet != "" {
+		g.activeSheet = sheet
 	}
-	if colTo, rowTo, xlError = xlsx.GetCoordsFromCellIDString(toIDString); xlError != nil {
-		err = xlError
-		return
+
+	// Whole columns and rows stop at the used area of the sheet
+	if ref.IsWholeColumn() {
+		ref.To.Row = bound(ref.To.Row, ref.From.Row, sheet.MaxRow-1)
+	}
+	if ref.IsWholeRow() {
+		ref.To.Col = bound(ref.To.Col, ref.From.Col, sheet.MaxCol-1)
 	}
 
-	rowCount := rowTo - rowFrom + 1
-	colCount := colTo - colFrom + 1
+	rowCount := ref.To.Row - ref.From.Row + 1
+	colCount := ref.To.Col - ref.From.Col + 1
 	cellRange = Range{
 		cells:    make([]Cell, rowCount*colCount),
 		rowCount: rowCount,
@@ -155,12 +264,9 @@ func (g *Engine) GetRange(rangeIDString string) (cellRange Range, err error) {
 	}
 	for i := 0; i < rowCount; i++ {
 		for j := 0; j < colCount; j++ {
-			xlCell := sheet.Cell(rowFrom+i, colFrom+j)
-			cell := Cell{}
-			if f, err := strconv.ParseFloat(xlCell.Value, 64); err != nil {
-				cell.value = xlCell.Value
-			} else {
-				cell.value = f
+			xlCell := sheet.Cell(ref.From.Row+i, ref.From.Col+j)
+			cell := Cell{
+				value: cellValue(xlCell),
 			}
 
 			if formula := xlCell.Formula(); formula != "" {
@@ -173,42 +279,123 @@ func (g *Engine) GetRange(rangeIDString string) (cellRange Range, err error) {
 	return
 }
 
+// bound Clamp the far end of a range to limit, keeping at least one cell
+func bound(to int, from int, limit int) int {
+	if to > limit {
+		to = limit
+	}
+	if to < from {
+		to = from
+	}
+	return to
+}
+
 func (g *Engine) GetCell(cellIDString string) (cell Cell, err error) {
 	if len(cellIDString) == 0 {
 		err = Error("Invalid address")
 		return
 	}
-	var sheet *xlsx.Sheet
-	if strings.Contains(cellIDString, "!") {
-		splat := strings.Split(cellIDString, "!")
-		sheet = g.xlFile.Sheet[splat[0]]
+
+	var ref f1F.Reference
+	if ref, err = g.reference(cellIDString); err != nil {
+		return
+	}
+
+	return g.getCell(ref)
+}
+
+func (g *Engine) getCell(ref f1F.Reference) (cell Cell, err error) {
+	sheet := g.sheet(ref)
+	if sheet == nil {
+		err = funs.ErrRef
+		return
+	} else if ref.Sheet != "" {
 		g.activeSheet = sheet
-		cellIDString = splat[1]
-	} else if g.activeSheet != nil {
-		sheet = g.activeSheet
-	} else {
-		sheet = g.xlFile.Sheets[0]
 	}
 
-	if col, row, xlError := xlsx.GetCoordsFromCellIDString(cellIDString); xlError != nil {
-		err = xlError
+	xlCell := sheet.Cell(ref.From.Row, ref.From.Col)
+	g.logger.Debugf("Cell: %s, fmt: %s", ref, xlCell.NumFmt)
+
+	cell.value = cellValue(xlCell)
+	if formula := xlCell.Formula(); formula != "" {
+		cell.formula = `=` + formula
+	}
+
+	return
+}
+
+// Precedents Cells, ranges and defined names the formula of a cell reads
+// directly, without evaluating it. Empty for cells holding a plain value.
+// Names scoped to the sheet of the cell come qualified with it
+func (g *Engine) Precedents(cellID string) (precedents []f1F.Dependency, err error) {
+	var ref f1F.Reference
+	if ref, err = g.reference(cellID); err != nil {
 		return
-	} else {
-		xlCell := sheet.Cell(row, col)
-		logger.Printf("Cell: %s, fmt: %s", cellIDString, xlCell.NumFmt)
+	} else if ref.IsRange() {
+		err = fmt.Errorf("%s is not a single cell", cellID)
+		return
+	}
 
-		if f, err := strconv.ParseFloat(xlCell.Value, 64); err != nil {
-			cell.value = xlCell.Value
-		} else {
-			cell.value = f
-		}
+	sheet := g.sheet(ref)
+	if sheet == nil {
+		err = funs.ErrRef
+		return
+	}
 
-		if formula := xlCell.Formula(); formula != "" {
-			cell.formula = `=` + formula
-		}
+	formulaString := sheet.Cell(ref.From.Row, ref.From.Col).Formula()
+	if formulaString == "" {
+		return []f1F.Dependency{}, nil
+	}
 
+	var formula *f1F.Formula
+	if formula, err = g.compile("=" + formulaString); err != nil {
 		return
 	}
+
+	precedents = formula.Dependencies(sheet.Name)
+	for i, precedent := range precedents {
+		if _, ok := g.names[nameKey(sheet.Name, precedent.Name)]; ok && precedent.IsName() && precedent.Reference.Sheet == "" {
+			precedents[i].Reference.Sheet = sheet.Name
+		}
+	}
+	return
+}
+
+// sheet Sheet a reference points to, the active sheet when it names none.
+// Nil when the named sheet does not exist or there are several (3D)
+func (g *Engine) sheet(ref f1F.Reference) *xlsx.Sheet {
+	if ref.LastSheet != "" {
+		return nil
+	} else if ref.Sheet != "" {
+		return g.xlFile.Sheet[ref.Sheet]
+	} else if g.activeSheet != nil {
+		return g.activeSheet
+	}
+	return g.xlFile.Sheets[0]
+}
+
+// cacheKey Sheet qualified address of a reference, e.g. B2 and $B$2 on the
+// active sheet Input are both Input!B2
+func (g *Engine) cacheKey(ref f1F.Reference) string {
+	return g.qualified(ref).String()
+}
+
+// qualified The reference on the active sheet when it names no sheet
+func (g *Engine) qualified(ref f1F.Reference) f1F.Reference {
+	if sheet := g.sheet(ref); ref.Sheet == "" && sheet != nil {
+		ref.Sheet = sheet.Name
+	}
+	return ref
+}
+
+// cellValue Value of a spreadsheet cell as number, error value or text
+func cellValue(xlCell *xlsx.Cell) interface{} {
+	if f, err := strconv.ParseFloat(xlCell.Value, 64); err == nil {
+		return f
+	} else if excelError, ok := funs.ParseExcelError(xlCell.Value); ok {
+		return excelError
+	}
+	return xlCell.Value
 }
 
 func (g *Engine) Inspect() map[string]string {
@@ -224,15 +411,16 @@ func (g *Engine) Execute(inputs map[string]string, outputs *map[string]OutParam)
 	}
 
 	for cellIDString := range *outputs {
-		if strings.Contains(cellIDString, ":") {
+		// Outputs are cells, ranges or the defined names of either
+		if ref, refErr := g.reference(cellIDString); refErr == nil && ref.IsRange() {
 			if (*outputs)[cellIDString].Format != "$ref" {
-				logger.Printf("CellID %s must have $ref format", cellIDString)
+				g.logger.Warnf("CellID %s must have $ref format", cellIDString)
 				continue
 			}
 
 			var cellRange Range
 			if cellRange, err = g.GetRange(cellIDString); err != nil {
-				logger.Printf("***Could not get range %s. Reason: %v\n", cellIDString, err)
+				g.logger.Warnf("Could not get range %s. Reason: %v", cellIDString, err)
 				return
 			}
 
@@ -240,15 +428,11 @@ func (g *Engine) Execute(inputs map[string]string, outputs *map[string]OutParam)
 				result := make([]string, len(cells))
 				for i := range result {
 					if formulaString := cells[i].formula; formulaString != "" {
-						logger.Printf("Evaluating cell[%d]: %s, f(x) %s\n", i, cellIDString, formulaString)
+						g.logger.Debugf("Evaluating cell[%d]: %s, f(x) %s", i, cellIDString, formulaString)
 
 						var formula *f1F.Formula
-						if cached, ok := g.formulaCache[formulaString]; ok {
-							logger.Printf("Formula found '%s' in cache\n", formulaString)
-							formula = cached
-						} else {
-							formula = f1F.NewFormula(formulaString)
-							g.formulaCache[formulaString] = formula
+						if formula, err = g.compile(formulaString); err != nil {
+							return
 						}
 
 						g.EvalFormula(formula) // g.ax is updated
@@ -266,12 +450,8 @@ func (g *Engine) Execute(inputs map[string]string, outputs *map[string]OutParam)
 					for j := 0; j < cellRange.colCount; j++ {
 						if formulaString := cells[i][j].formula; formulaString != "" {
 							var formula *f1F.Formula
-							if cached, ok := g.formulaCache[formulaString]; ok {
-								logger.Printf("Formula found '%s' in cache\n", formulaString)
-								formula = cached
-							} else {
-								formula = f1F.NewFormula(formulaString)
-								g.formulaCache[formulaString] = formula
+							if formula, err = g.compile(formulaString); err != nil {
+								return
 							}
 
 							g.EvalFormula(formula) // g.ax is updated
@@ -290,19 +470,16 @@ func (g *Engine) Execute(inputs map[string]string, outputs *map[string]OutParam)
 			var cell Cell
 			cell, err = g.GetCell(cellIDString)
 			if err != nil {
-				logger.Printf("***Could not get cell %s. Reason: %v\n", cellIDString, err)
+				g.logger.Warnf("Could not get cell %s. Reason: %v", cellIDString, err)
 				return
 			}
 			if cell.formula != "" {
-				logger.Printf("Formula: %s\n\n", cell.formula)
+				g.logger.Debugf("Formula: %s", cell.formula)
 
 				var formula *f1F.Formula
-				if cached, ok := g.formulaCache[cell.formula]; ok {
-					logger.Printf("Formula found '%s' in cache\n", cell.formula)
-					formula = cached
-				} else {
-					formula = f1F.NewFormula(cell.formula)
-					g.formulaCache[cell.formula] = formula
+				if formula, err = g.compile(cell.formula); err != nil {
+					g.logger.Warnf("Could not parse cell %s. Reason: %v", cellIDString, err)
+					return
 				}
 
 				value, _ := g.EvalFormula(formula)
@@ -317,21 +494,53 @@ func (g *Engine) Execute(inputs map[string]string, outputs *map[string]OutParam)
 	return
 }
 
+// invalid Value of a formula which does not parse, #NAME? like Excel gives
+// for text it cannot make sense of
+func (g *Engine) invalid(formulaString string, err error) interface{} {
+	g.logger.Warnf("Could not parse %s. Reason: %v", formulaString, err)
+	return funs.ErrName
+}
+
+// compile Parse formula text, reusing formulas parsed earlier
+func (g *Engine) compile(formulaString string) (formula *f1F.Formula, err error) {
+	if cached, ok := g.formulaCache[formulaString]; ok {
+		g.logger.Debugf("Formula found '%s' in cache", formulaString)
+		formula = cached
+		return
+	}
+
+	if formula, err = f1F.Parse(formulaString); err != nil {
+		return
+	}
+	g.formulaCache[formulaString] = formula
+	return
+}
+
 // EvalFormula Execute formula by running AST nodes as necessary
 func (g *Engine) EvalFormula(f *f1F.Formula) (value interface{}, valueType f1F.NodeType) {
 	var currentNode *f1F.Node
 
-	currentNode = f.GetEntryNode()
-	logger.Printf(">>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>\n")
-	logger.Printf("Evaluating formula...\n")
-	logger.Printf("- Entry: %v\n", currentNode.Value())
+	if g.depth == 0 {
+		g.nodeErrors = nil
+	}
+	g.depth++
+	defer func() { g.depth-- }()
+
+	if currentNode = f.GetEntryNode(); currentNode == nil {
+		g.logger.Warnf("Formula has no entry node")
+		value = funs.ErrName
+		valueType = 0
+		return
+	}
+	g.logger.Debugf("Evaluating formula...")
+	g.logger.Debugf("- Entry: %v", currentNode.Value())
 
 	stackHeight := g.callstack.Len()
 	err := g.evalNode(currentNode)
 	if g.callstack.Len() != stackHeight {
 		// panic(errors.New(fmt.Sprintf("Stack not disposed properly: was %d, now %d",
 		// 	stackHeight, g.callstack.Len())))
-		logger.Printf("***Stack not disposed properly: was %d, now %d ***\n",
+		g.logger.Errorf("Stack not disposed properly: was %d, now %d",
 			stackHeight, g.callstack.Len())
 	}
 
@@ -340,14 +549,13 @@ func (g *Engine) EvalFormula(f *f1F.Formula) (value interface{}, valueType f1F.N
 		valueType = 0
 		return
 	} else if g.ax == nil {
-		value = "#NA"
+		value = funs.ErrNA
 		valueType = 0
 		return
 	}
 
 	value = g.ax
-	logger.Printf("f() = %v\n", value)
-	logger.Printf("<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<\n")
+	g.logger.Debugf("f() = %v", value)
 	switch g.ax.(type) {
 	case string:
 		valueType = f1F.NodeTypeLiteral
@@ -357,27 +565,81 @@ func (g *Engine) EvalFormula(f *f1F.Formula) (value interface{}, valueType f1F.N
 		valueType = f1F.NodeTypeFloat
 	case float64:
 		valueType = f1F.NodeTypeFloat
+	case bool:
+		valueType = f1F.NodeTypeBoolean
 	}
 	return
 }
 
-// SetCell Set value for a cell
+// LastErrors Failures met by the last EvalFormula call, each locating the
+// node of the formula that failed, e.g. an unknown function. The value of the
+// node is an error value such as #NAME?. Failures within the formulas of the
+// cells read on the way are only logged
+func (g *Engine) LastErrors() []*NodeError {
+	return g.nodeErrors
+}
+
+// fail Log the failure of a node, keeping it for LastErrors when the node is
+// part of the formula given to EvalFormula
+func (g *Engine) fail(message string, span f1F.Span) {
+	err := &NodeError{Message: message, Span: span}
+	g.logger.Warnf("%v", err)
+	if g.depth == 1 {
+		g.nodeErrors = append(g.nodeErrors, err)
+	}
+}
+
+// SetCell Set value for a cell. Formula cells depending on it are computed
+// again when next read, the others keep their cached values
 func (g *Engine) SetCell(cellID string, value interface{}) {
-	var sheetName string
-	if strings.Contains(cellID, "!") {
-		splat := strings.Split(cellID, "!")
-		sheetName = splat[0]
-		cellID = splat[1]
-	} else {
-		sheetName = "Input"
+	ref, err := g.reference(cellID)
+	if err != nil || ref.LastSheet != "" {
+		return
+	}
+	if ref.Sheet == "" {
+		ref.Sheet = "Input"
 	}
 
-	sheet := g.xlFile.Sheet[sheetName]
-	if col, row, err := xlsx.GetCoordsFromCellIDString(cellID); err != nil {
+	sheet, ok := g.xlFile.Sheet[ref.Sheet]
+	if !ok {
 		return
-	} else {
-		cell := sheet.Cell(row, col)
-		cell.SetValue(value)
+	}
+	cell := sheet.Cell(ref.From.Row, ref.From.Col)
+	formula := cell.Formula()
+	cell.SetValue(value)
+
+	g.invalidate(cellOf(ref))
+	if formula != "" {
+		// The cell reads nothing anymore, its value replaced the formula
+		g.graph = nil
+	}
+}
+
+// invalidate Drop the cached values of c and of the formula cells
+// depending on it, directly or not, so only those are computed again when
+// next read. Cached ranges holding any of them go as well
+func (g *Engine) invalidate(c cell) {
+	graph := g.dependencyGraph()
+	dirty := []cell{c}
+	for _, id := range graph.dependentsClosure(c.reference()) {
+		dirty = append(dirty, graph.cells[id])
+	}
+
+	for _, dirtyCell := range dirty {
+		key := dirtyCell.String()
+		if _, ok := g.cache[key]; ok {
+			g.logger.Debugf("Invalidated %s", key)
+			delete(g.cache, key)
+		}
+	}
+
+	cells := newCellSet(dirty)
+	for key, area := range g.cachedRanges {
+		if cells.intersects(area) {
+			g.logger.Debugf("Invalidated %s", key)
+			delete(g.cache, key)
+			delete(g.cachedRanges, key)
+		}
 	}
 }
 
@@ -395,6 +657,27 @@ func (g *Engine) leave() {
 	g.callstack.Pop()
 }
 
+// popOperands Pop arity operands, in the order they were pushed
+func (g *Engine) popOperands(arity int) []interface{} {
+	operands := make([]interface{}, arity)
+	for i := arity - 1; i >= 0; i-- {
+		g.pop(&operands[i])
+	}
+	return operands
+}
+
+// popNumbers Pop arity operands as numbers. The leftmost error operand wins.
+func (g *Engine) popNumbers(arity int) (numbers []float64, err error) {
+	operands := g.popOperands(arity)
+	numbers = make([]float64, arity)
+	for i, operand := range operands {
+		if numbers[i], err = funs.Number(operand); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // runStack Execute an invoke and store output in ax
 // Output: ax register
 func (g *Engine) runStack(invoke *Invoke) {
@@ -403,180 +686,65 @@ func (g *Engine) runStack(invoke *Invoke) {
 		var operand interface{}
 		g.pop(&operand)
 		ret = operand
-	} else if invoke.fn == "+" {
-		var operand interface{}
-		var ax float64
-
-		for i := invoke.arity; i >= 1; i-- {
-			g.pop(&operand)
-			switch operand.(type) {
-			case float64:
-				ax += operand.(float64)
-				break
-			case int:
-				ax += float64(operand.(int))
-				break
-			}
-		}
-		ret = ax
-	} else if invoke.fn == "-" {
-		var operand interface{}
-		var ax float64 = 0.0
-
-		for i := invoke.arity; i >= 2; i-- {
-			g.pop(&operand)
-			switch operand.(type) {
-			case float64:
-				ax += operand.(float64)
-				break
-			case int:
-				ax += float64(operand.(int))
-				break
-			}
-		}
-
-		g.pop(&operand)
-		switch operand.(type) {
-		case float64:
-			ret = operand.(float64) - ax
-			break
-		case int:
-			ret = float64(operand.(int)) - ax
-			break
-		default:
-			ret = 0.0
-			break
-		}
-	} else if invoke.fn == "*" {
-		var operand interface{}
-		var ax float64
-		ax = 1.0
-
-		for i := invoke.arity; i >= 1; i-- {
-			g.pop(&operand)
-
-			switch operand.(type) {
-			case float64:
-				ax *= operand.(float64)
-				break
-			case int:
-				ax *= float64(operand.(int))
-				break
-			}
-		}
-		ret = ax
-	} else if invoke.fn == "/" {
-		var operand interface{}
-		var ax float64 = 1.0
-
-		for i := invoke.arity; i >= 2; i-- {
-			g.pop(&operand)
-
-			switch operand.(type) {
-			case float64:
-				ax *= operand.(float64)
-				break
-			case int:
-				ax *= float64(operand.(int))
-				break
-			}
-		}
-
-		g.pop(&operand)
-		switch operand.(type) {
-		case float64:
-			ret = operand.(float64) / ax
-			break
-		case int:
-			ret = float64(operand.(int)) / ax
-			break
-		default:
-			ret = errors.New("N/A")
+	} else if arithmetics[invoke.fn] {
+		if numbers, err := g.popNumbers(invoke.arity); err != nil {
+			ret = err
+		} else {
+			ret = arithmetic(invoke.fn, numbers)
 		}
-	} else if strings.Contains(">=<=", invoke.fn) {
+	} else if invoke.fn == "&" {
+		ret = funs.CONCATENATE(g.popOperands(invoke.arity)...)
+	} else if comparisons[invoke.fn] {
 		var operand1, operand2 interface{}
 		g.pop(&operand2)
 		g.pop(&operand1)
 
-		switch operand1.(type) {
-		case error:
-			ret = operand1.(error)
-			break
-		case float64:
-			switch operand2.(type) {
-			case error:
-				ret = operand2.(error)
-				break
-			case float64:
-				ret = g.logicalFloat64(invoke.fn, operand1.(float64), operand2.(float64))
-				break
-			case string:
-				panic(fmt.Errorf("Operation not supported: float64 %f vs string '%s'",
-					operand1.(float64), operand2.(string)))
-				break
-			}
-			break
-		case string:
-			switch operand2.(type) {
-			case error:
-				ret = operand2.(error)
-				break
-			case float64:
-				panic(fmt.Errorf("Operation not supported: string '%s' vs float64 %f",
-					operand1.(string), operand2.(float64)))
-				break
-			case string:
-				ret = g.logicalString(invoke.fn, operand1.(string), operand2.(string))
-				break
-			}
-			break
+		if order, err := compare(operand1, operand2); err != nil {
+			ret = err
+		} else {
+			ret = logical(invoke.fn, order)
 		}
-
 	} else {
 		// Non primitive operators: + - * /
 		// NOTE: DO NOT REFACTOR INTO DYNAMIC METHOD CALLING WITH ARGS...
-		if invoke.arity == 1 {
-			var operand1 interface{}
-			g.pop(&operand1)
-			logger.Printf("Call1: %s, %v\n", invoke.fn, operand1)
-			if output, err := funs.Call1(invoke.fn, operand1); err != nil {
-				ret = err
+		operands := g.popOperands(invoke.arity)
+		if err := argumentError(invoke.fn, operands); err != nil {
+			ret = err
+		} else if invoke.arity == 1 {
+			g.logger.Debugf("Call1: %s, %v", invoke.fn, operands[0])
+			if output, err := funs.Call1(invoke.fn, operands[0]); err != nil {
+				g.fail(fmt.Sprintf("%v with %d arguments", err, invoke.arity), invoke.span)
+				ret = funs.ErrValue
 			} else {
 				ret = output
 			}
 		} else if invoke.arity == 2 {
-			var operand1, operand2 interface{}
-			g.pop(&operand2)
-			g.pop(&operand1)
-			logger.Printf("Call2: %s, %v, %v\n", invoke.fn, operand1, operand2)
-			if output, err := funs.Call2(invoke.fn, operand1, operand2); err != nil {
-				ret = err
+			g.logger.Debugf("Call2: %s, %v, %v", invoke.fn, operands[0], operands[1])
+			if output, err := funs.Call2(invoke.fn, operands[0], operands[1]); err != nil {
+				g.fail(fmt.Sprintf("%v with %d arguments", err, invoke.arity), invoke.span)
+				ret = funs.ErrValue
 			} else {
 				ret = output
 			}
 		} else if invoke.arity == 3 {
-			var operand1, operand2, operand3 interface{}
-			g.pop(&operand3)
-			g.pop(&operand2)
-			g.pop(&operand1)
-			logger.Printf("Call3: %s, %v, %v, %v\n", invoke.fn, operand1, operand2, operand3)
-			if output, err := funs.Call3(invoke.fn, operand1, operand2, operand3); err != nil {
-				ret = err
+			g.logger.Debugf("Call3: %s, %v, %v, %v", invoke.fn, operands[0], operands[1], operands[2])
+			if output, err := funs.Call3(invoke.fn, operands[0], operands[1], operands[2]); err != nil {
+				g.fail(fmt.Sprintf("%v with %d arguments", err, invoke.arity), invoke.span)
+				ret = funs.ErrValue
 			} else {
 				ret = output
 			}
 		} else if invoke.arity == 4 {
-			var operand1, operand2, operand3, operand4 interface{}
-			g.pop(&operand4)
-			g.pop(&operand3)
-			g.pop(&operand2)
-			g.pop(&operand1)
-			logger.Printf("Call4: %s, %v, %v, %v, %v\n", invoke.fn, operand1, operand2, operand3, operand4)
-			if output, err := funs.Call4(invoke.fn, operand1, operand2, operand3, operand4); err != nil {
-				ret = err
+			g.logger.Debugf("Call4: %s, %v, %v, %v, %v", invoke.fn, operands[0], operands[1], operands[2], operands[3])
+			if output, err := funs.Call4(invoke.fn, operands[0], operands[1], operands[2], operands[3]); err != nil {
+				g.fail(fmt.Sprintf("%v with %d arguments", err, invoke.arity), invoke.span)
+				ret = funs.ErrValue
 			} else {
 				ret = output
 			}
+		} else {
+			g.fail(fmt.Sprintf("Invalid fun %s with %d arguments", invoke.fn, invoke.arity), invoke.span)
+			ret = funs.ErrValue
 		}
 	}
 	// NOTE: Remember to g.pop after g.runStack
@@ -585,63 +753,224 @@ func (g *Engine) runStack(invoke *Invoke) {
 
 func (g *Engine) evalNode(node *f1F.Node) (err error) {
 	switch node.NodeType() {
-	case f1F.NodeTypeOperator:
+	case f1F.NodeTypeOperator, f1F.NodeTypePrefix, f1F.NodeTypePostfix:
 		if err = g.callFunc(node); err != nil {
 			return
 		}
 		break
 	case f1F.NodeTypeFunc:
-		if node.Value() == "TRUE" {
-			g.ax = true
-		} else if node.Value() == "FALSE" {
-			g.ax = false
-		} else {
-			err = g.callFunc(node)
-			if err != nil {
-				return
-			}
+		err = g.callFunc(node)
+		if err != nil {
+			return
 		}
 		break
 	case f1F.NodeTypeRef:
 		g.callDeref(node)
 		break
-	case f1F.NodeTypeLiteral, f1F.NodeTypeFloat, f1F.NodeTypeInteger:
+	case f1F.NodeTypeLiteral, f1F.NodeTypeFloat, f1F.NodeTypeInteger, f1F.NodeTypeBoolean:
 		g.ax = node.Value()
 		break
+	case f1F.NodeTypeError:
+		g.ax = errorValue(node)
+		break
+	case f1F.NodeTypeMissing:
+		g.ax = missingValue
+		break
+	case f1F.NodeTypeArray:
+		g.ax = arrayValue(node)
+		break
 	}
 
 	return
 }
 
-func (g *Engine) logicalFloat64(fn string, operand1 float64, operand2 float64) bool {
-	if fn == ">" {
-		return operand1 > operand2
-	} else if fn == "<" {
-		return operand1 < operand2
-	} else if fn == "=" {
-		return operand1 == operand2
-	} else if fn == ">=" {
-		return operand1 >= operand2
-	} else if fn == "<=" {
-		return operand1 <= operand2
-	} else {
-		panic(errors.New(fmt.Sprintf("Invalid operator %s", fn)))
+// missingValue Value of an omitted argument, IF(A1,,2) gives 0 like Excel
+var missingValue = float64(0)
+
+// errorValue Error value of an error literal node
+func errorValue(node *f1F.Node) error {
+	if err, ok := funs.ParseExcelError(node.Value().(string)); ok {
+		return err
 	}
+	return funs.ErrValue
 }
 
-func (g *Engine) logicalString(fn string, operand1 string, operand2 string) bool {
-	if fn == ">" {
-		return operand1 > operand2
-	} else if fn == "<" {
-		return operand1 < operand2
-	} else if fn == "=" {
-		return operand1 == operand2
-	} else if fn == ">=" {
-		return operand1 >= operand2
-	} else if fn == "<=" {
-		return operand1 <= operand2
-	} else {
-		panic(errors.New(fmt.Sprintf("Invalid operator %s", fn)))
+// arrayValue Values of an array constant, shaped the way callDeref shapes ranges:
+// a single row or column becomes []interface{}, anything else [][]interface{}
+func arrayValue(node *f1F.Node) interface{} {
+	rows := node.Children()
+	rowCount := len(rows)
+	colCount := node.FirstChild().ChildCount()
+
+	values := make([][]interface{}, rowCount)
+	for i, row := range rows {
+		values[i] = make([]interface{}, colCount)
+		for j, element := range row.Children() {
+			if element.NodeType() == f1F.NodeTypeError {
+				values[i][j] = errorValue(element)
+			} else {
+				values[i][j] = element.Value()
+			}
+		}
+	}
+
+	if rowCount == 1 && colCount > 1 {
+		return values[0]
+	} else if colCount == 1 && rowCount > 1 {
+		column := make([]interface{}, rowCount)
+		for i := range values {
+			column[i] = values[i][0]
+		}
+		return column
+	}
+	return values
+}
+
+// argumentError First error passed as argument to fn. MS-EXCEL functions
+// propagate error arguments, except IFERROR which exists to catch them.
+func argumentError(fn string, operands []interface{}) error {
+	if fn == "IFERROR" {
+		return nil
+	}
+
+	for _, operand := range operands {
+		if err, ok := operand.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// arithmetic Fold numbers left to right with an arithmetic operator
+// - Division by zero: #DIV/0!
+// - Result not representable, e.g. (-8)^0.5: #NUM!
+func arithmetic(fn string, numbers []float64) interface{} {
+	ax := numbers[0]
+	if fn == "-" && len(numbers) == 1 {
+		// Unary minus
+		return -ax
+	} else if fn == "%" {
+		return ax / 100
+	}
+
+	for _, operand := range numbers[1:] {
+		switch fn {
+		case "+":
+			ax += operand
+		case "-":
+			ax -= operand
+		case "*":
+			ax *= operand
+		case "/":
+			if operand == 0 {
+				return funs.ErrDiv0
+			}
+			ax /= operand
+		case "^":
+			if ax == 0 && operand < 0 {
+				return funs.ErrDiv0
+			}
+			// Left associative, as POWER(POWER(a, b), c)
+			ax = funs.POWER(ax, operand)
+		}
+	}
+
+	if math.IsNaN(ax) || math.IsInf(ax, 0) {
+		return funs.ErrNum
+	}
+	return ax
+}
+
+// compare Order two operands the way MS-EXCEL does
+// - Numbers < text < booleans, whatever their values
+// - Text is compared case-insensitively
+// - Blank equals 0, "" or FALSE depending on the other operand
+// - Errors are propagated, ranges are #VALUE!
+func compare(operand1 interface{}, operand2 interface{}) (order int, err error) {
+	operand1, operand2 = blank(operand1, operand2), blank(operand2, operand1)
+
+	var rank1, rank2 int
+	if rank1, err = rank(operand1); err != nil {
+		return
+	}
+	if rank2, err = rank(operand2); err != nil {
+		return
+	}
+	if rank1 != rank2 {
+		order = rank1 - rank2
+		return
+	}
+
+	switch operand1.(type) {
+	case float64, int:
+		number1, _ := funs.Number(operand1)
+		number2, _ := funs.Number(operand2)
+		if number1 < number2 {
+			order = -1
+		} else if number1 > number2 {
+			order = 1
+		}
+	case string:
+		order = strings.Compare(strings.ToLower(operand1.(string)), strings.ToLower(operand2.(string)))
+	case bool:
+		if operand1.(bool) == operand2.(bool) {
+			order = 0
+		} else if operand2.(bool) {
+			order = -1
+		} else {
+			order = 1
+		}
+	}
+	return
+}
+
+// blank Substitute a blank operand with the zero value matching the other operand
+func blank(operand interface{}, other interface{}) interface{} {
+	if operand != nil && operand != "" {
+		return operand
+	}
+
+	switch other.(type) {
+	case float64, int:
+		return 0.0
+	case bool:
+		return false
+	default:
+		return ""
+	}
+}
+
+// rank Position of the operand's type in the comparison order
+func rank(operand interface{}) (int, error) {
+	switch operand.(type) {
+	case float64, int:
+		return 0, nil
+	case string:
+		return 1, nil
+	case bool:
+		return 2, nil
+	case error:
+		return 0, operand.(error)
+	default:
+		return 0, funs.ErrValue
+	}
+}
+
+// logical Apply a comparison operator to the order of its operands
+func logical(fn string, order int) bool {
+	switch fn {
+	case ">":
+		return order > 0
+	case "<":
+		return order < 0
+	case ">=":
+		return order >= 0
+	case "<=":
+		return order <= 0
+	case "<>":
+		return order != 0
+	default:
+		return order == 0
 	}
 }
 
@@ -650,9 +979,17 @@ func (g *Engine) callFunc(node *f1F.Node) (err error) {
 	var fn string
 	fn = node.Value().(string)
 
+	if fn == "TRUE" || fn == "FALSE" {
+		g.ax = fn == "TRUE"
+		return
+	}
+
 	if fn == "IF" { // The IF-JUMP
 		if g.callIf(node.FirstChild()) {
 			err = g.evalNode(node.ChildAt(1))
+		} else if condition, ok := g.ax.(error); ok {
+			// An error condition propagates instead of choosing a branch
+			g.ax = condition
 		} else if falseBranch := node.ChildAt(2); falseBranch != nil {
 			err = g.evalNode(falseBranch)
 		} else {
@@ -666,9 +1003,15 @@ func (g *Engine) callFunc(node *f1F.Node) (err error) {
 		return
 	}
 
-	if !strings.Contains("IDENTITY+-*/>=<=", fn) && !funs.Exists(fn) {
-		println(fmt.Sprintf("Function not exists: %s", fn))
-		err = errors.New(fmt.Sprintf("Function not exists: %s", fn))
+	if rangeOperators[fn] {
+		g.ax = g.callRangeOperator(node)
+		return
+	}
+
+	if !operators[fn] && !funs.Exists(fn) {
+		// Like Excel, an unknown function is a #NAME? value, not a failure
+		g.fail(fmt.Sprintf("Function not exists: %s", fn), node.Span())
+		g.ax = funs.ErrName
 		return
 	}
 
@@ -676,6 +1019,7 @@ func (g *Engine) callFunc(node *f1F.Node) (err error) {
 	invoke = &Invoke{
 		fn:    fn,
 		arity: node.ChildCount(),
+		span:  node.Span(),
 	}
 
 	for _, childNode := range node.Children() {
@@ -688,11 +1032,20 @@ func (g *Engine) callFunc(node *f1F.Node) (err error) {
 			value := childNode.Value()
 			g.push(value)
 			break
-		case f1F.NodeTypeFloat:
+		case f1F.NodeTypeFloat, f1F.NodeTypeBoolean:
 			value := childNode.Value()
 			g.push(value)
 			break
-		case f1F.NodeTypeOperator:
+		case f1F.NodeTypeError:
+			g.push(errorValue(childNode))
+			break
+		case f1F.NodeTypeMissing:
+			g.push(missingValue)
+			break
+		case f1F.NodeTypeArray:
+			g.push(arrayValue(childNode))
+			break
+		case f1F.NodeTypeOperator, f1F.NodeTypePrefix, f1F.NodeTypePostfix:
 			err = g.callFunc(childNode)
 			if err != nil {
 				return
@@ -703,7 +1056,7 @@ func (g *Engine) callFunc(node *f1F.Node) (err error) {
 			stackHeight := g.callstack.Len()
 			err = g.callFunc(childNode)
 			if stackHeight != g.callstack.Len() {
-				logger.Printf("***Stack corruption: was %d, now %d***\n", stackHeight, g.callstack.Len())
+				g.logger.Errorf("Stack corruption: was %d, now %d", stackHeight, g.callstack.Len())
 			}
 
 			if err != nil {
@@ -723,37 +1076,71 @@ func (g *Engine) callDeref(node *f1F.Node) {
 	cellIDString := node.Value().(string)
 	activeSheet := g.activeSheet
 
-	if result, ok := g.cache[cellIDString]; ok {
+	ref, err := f1F.ParseReference(cellIDString)
+	if err != nil {
+		refersTo, ok := g.resolveName(cellIDString)
+		if !ok {
+			g.logger.Warnf("Could not deref %s. Reason: %v", cellIDString, err)
+			g.ax = funs.ErrName
+			return
+		}
+
+		if ref, err = f1F.ParseReference(refersTo); err != nil {
+			// Names may also stand for constants and formulas, e.g. 0.05
+			if formula, err := g.compile("=" + refersTo); err != nil {
+				g.ax = g.invalid(refersTo, err)
+			} else {
+				g.EvalFormula(formula) // g.ax is updated
+			}
+			g.activeSheet = activeSheet
+			return
+		}
+	}
+
+	g.deref(ref)
+	g.activeSheet = activeSheet
+}
+
+// deref Load the value(s) of a reference into g.ax, evaluating formulas of
+// the cells on the way
+func (g *Engine) deref(ref f1F.Reference) {
+	if ref.LastSheet != "" {
+		g.ax = g.deref3D(ref)
+		return
+	}
+
+	cellIDString := ref.String()
+	key := g.cacheKey(ref)
+
+	if result, ok := g.cache[key]; ok {
 		g.ax = result
 	} else {
-		if strings.Contains(cellIDString, ":") {
+		if ref.IsRange() {
 			// Request for a range, even for single dimension ranges
-			if cellRange, err := g.GetRange(cellIDString); err != nil {
-				logger.Printf("Could not deref %s. Reason: %v", cellIDString, err)
+			if cellRange, err := g.getRange(ref); err != nil {
+				g.logger.Warnf("Could not deref %s. Reason: %v", cellIDString, err)
+				g.ax = funs.ErrRef
 				return
 			} else {
 				if cells, ok := cellRange.ToSlice(); ok {
 					result := make([]interface{}, len(cells))
 					for i := range result {
 						if formulaString := cells[i].formula; formulaString != "" {
-							logger.Printf("Evaluating cell[%d]: %s, f(x) %s\n", i, cellIDString, formulaString)
+							g.logger.Debugf("Evaluating cell[%d]: %s, f(x) %s", i, cellIDString, formulaString)
 
-							var formula *f1F.Formula
-							if cached, ok := g.formulaCache[formulaString]; ok {
-								logger.Printf("Formula found '%s' in cache\n", formulaString)
-								formula = cached
+							if formula, err := g.compile(formulaString); err != nil {
+								result[i] = g.invalid(formulaString, err)
 							} else {
-								formula = f1F.NewFormula(formulaString)
+								g.EvalFormula(formula) // g.ax is updated
+								result[i] = g.ax
 							}
-
-							g.EvalFormula(formula) // g.ax is updated
-							result[i] = g.ax
 						} else {
 							result[i] = cells[i].value
 						}
 					}
 					g.ax = result
-					g.cache[cellIDString] = result
+					g.cache[key] = result
+					g.cachedRanges[key] = g.qualified(ref)
 				} else if cells, ok := cellRange.To2DSlice(); ok {
 					result := make([][]interface{}, cellRange.rowCount)
 					colCount := cellRange.colCount
@@ -761,9 +1148,12 @@ func (g *Engine) callDeref(node *f1F.Node) {
 						result[i] = make([]interface{}, colCount)
 						for j := 0; j < cellRange.colCount; j++ {
 							if formulaString := cells[i][j].formula; formulaString != "" {
-								formula := f1F.NewFormula(formulaString)
-								g.EvalFormula(formula) // g.ax is updated
-								result[i][j] = g.ax
+								if formula, err := g.compile(formulaString); err != nil {
+									result[i][j] = g.invalid(formulaString, err)
+								} else {
+									g.EvalFormula(formula) // g.ax is updated
+									result[i][j] = g.ax
+								}
 							} else {
 								result[i][j] = cells[i][j].value
 							}
@@ -771,36 +1161,165 @@ func (g *Engine) callDeref(node *f1F.Node) {
 						}
 					}
 					g.ax = result
-					g.cache[cellIDString] = result
+					g.cache[key] = result
+					g.cachedRanges[key] = g.qualified(ref)
 				}
 			}
 		} else {
-			if cell, err := g.GetCell(cellIDString); err != nil {
-				logger.Printf("Could not deref %s. Reason: %v\n", cellIDString, err)
-				g.activeSheet = activeSheet
+			if cell, err := g.getCell(ref); err != nil {
+				g.logger.Warnf("Could not deref %s. Reason: %v", cellIDString, err)
+				g.ax = funs.ErrRef
 				return
 			} else if cell.formula != "" {
-				logger.Printf("FORMULA: %s\n", cell.formula)
-				formula := f1F.NewFormula(cell.formula)
-				g.EvalFormula(formula) // g.ax is updated
-				g.cache[cellIDString] = g.ax
-			} else if cell.value != "" {
+				g.logger.Debugf("Formula: %s", cell.formula)
+				if formula, err := g.compile(cell.formula); err != nil {
+					g.ax = g.invalid(cell.formula, err)
+				} else {
+					g.EvalFormula(formula) // g.ax is updated
+				}
+				g.cache[key] = g.ax
+			} else {
 				g.ax = cell.value
 			}
 		}
 	}
 
-	logger.Printf(">>>>>\n")
-	if strings.Contains(cellIDString, "!") {
-		logger.Printf("Deref'd cell(s): %s = %v\n", cellIDString, g.ax)
-	} else if activeSheet != nil {
-		logger.Printf("Deref'd cell(s): %s!%s = %v\n", activeSheet.Name, cellIDString, g.ax)
-	} else {
-		logger.Printf("Deref'd cell(s): default first sheet! %s = %v\n", cellIDString, g.ax)
+	g.logger.Debugf("Deref'd cell(s): %s = %v", key, g.ax)
+	g.logger.Debugf("Stack height: %d", g.callstack.Len())
+}
+
+// deref3D Values of the same cells on a run of sheets, e.g. Jan:Dec!B5,
+// stacked sheet after sheet into one range
+func (g *Engine) deref3D(ref f1F.Reference) interface{} {
+	areas := g.sheetAreas(ref)
+	if areas == nil {
+		return funs.ErrRef
 	}
-	logger.Printf("Stack height: %d\n", g.callstack.Len())
-	logger.Printf("<<<<<\n")
-	g.activeSheet = activeSheet
+
+	stacked := []interface{}{}
+	for _, area := range areas {
+		g.deref(area)
+		stacked = appendCells(stacked, g.ax)
+	}
+	return stacked
+}
+
+// appendCells Append the cells of a value to a stacked range
+func appendCells(stacked []interface{}, value interface{}) []interface{} {
+	switch value.(type) {
+	case []interface{}:
+		return append(stacked, value.([]interface{})...)
+	case [][]interface{}:
+		for _, row := range value.([][]interface{}) {
+			stacked = append(stacked, row...)
+		}
+		return stacked
+	default:
+		return append(stacked, value)
+	}
+}
+
+// callRangeOperator Combine the references of a range, intersection or union
+// and load their cells. Several areas are stacked like a 3D reference
+func (g *Engine) callRangeOperator(node *f1F.Node) interface{} {
+	areas, err := g.areas(node)
+	if err != nil {
+		return err
+	}
+
+	activeSheet := g.activeSheet
+	defer func() { g.activeSheet = activeSheet }()
+
+	if len(areas) == 1 {
+		g.deref(areas[0])
+		return g.ax
+	}
+	stacked := []interface{}{}
+	for _, area := range areas {
+		g.deref(area)
+		stacked = appendCells(stacked, g.ax)
+	}
+	return stacked
+}
+
+// areas References a node stands for, with the sheet of each spelled out.
+// Nodes which are not references give #VALUE!
+func (g *Engine) areas(node *f1F.Node) (areas []f1F.Reference, err error) {
+	switch node.NodeType() {
+	case f1F.NodeTypeRef:
+		text := node.Value().(string)
+		ref, parseErr := f1F.ParseReference(text)
+		if parseErr != nil {
+			refersTo, ok := g.resolveName(text)
+			if !ok {
+				return nil, funs.ErrName
+			} else if ref, parseErr = f1F.ParseReference(refersTo); parseErr != nil {
+				return nil, funs.ErrValue
+			}
+		}
+
+		if ref.LastSheet != "" {
+			return nil, funs.ErrValue
+		} else if ref.Sheet == "" {
+			ref.Sheet = g.sheet(ref).Name
+		} else if g.sheet(ref) == nil {
+			return nil, funs.ErrRef
+		}
+		return []f1F.Reference{ref}, nil
+	case f1F.NodeTypeFunc:
+		if node.Value() == "IDENTITY" {
+			return g.areas(node.FirstChild())
+		}
+	case f1F.NodeTypeOperator:
+		if !rangeOperators[node.Value().(string)] {
+			break
+		}
+
+		for i, child := range node.Children() {
+			var childAreas []f1F.Reference
+			if childAreas, err = g.areas(child); err != nil {
+				return
+			}
+
+			if i == 0 {
+				areas = childAreas
+			} else if areas, err = combine(node.Value().(string), areas, childAreas); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	return nil, funs.ErrValue
+}
+
+// combine Apply a reference operator to the areas of two operands
+func combine(operator string, left []f1F.Reference, right []f1F.Reference) (areas []f1F.Reference, err error) {
+	switch operator {
+	case ",":
+		areas = append(left, right...)
+	case ":":
+		span := left[0]
+		for _, area := range append(left, right...) {
+			if area.Sheet != span.Sheet {
+				return nil, funs.ErrValue
+			}
+			span = span.Span(area)
+		}
+		areas = []f1F.Reference{span}
+	case " ":
+		for _, a := range left {
+			for _, b := range right {
+				if area, ok := a.Intersect(b); ok {
+					areas = append(areas, area)
+				}
+			}
+		}
+		if len(areas) == 0 {
+			return nil, funs.ErrNull
+		}
+	}
+	return
 }
 
 // callIf Evaluate a node to a bool in MS-EXCEL
@@ -1,12 +1,17 @@
 package engine
 
 import (
+	"bytes"
 	"encoding/json"
 	"math"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	f1Formula "github.com/khanhhua/formula1/formula"
+	"github.com/khanhhua/formula1/funs"
+	"github.com/sirupsen/logrus"
 	"github.com/tealeg/xlsx"
 )
 
@@ -131,6 +136,24 @@ func TestNumberLiteral(t *testing.T) {
 	}
 }
 
+func TestWithoutWorkbook(t *testing.T) {
+	engine := NewEngine(nil)
+	if result, _ := engine.EvalFormula(f1Formula.NewFormula(`=ROUND(1.25*2,0)&"!"`)); result != "3!" {
+		t.Errorf("Expected: 3!\tActual: %v", result)
+	}
+}
+
+func TestMalformedFormula(t *testing.T) {
+	engine := NewEngine(xlFile)
+	formula := f1Formula.NewFormula(`=SUM(1,`)
+
+	var result interface{}
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrName {
+		t.Errorf("Expected: #NAME?\tActual: %v", result)
+	}
+}
+
 func TestInfixOperationsOf2Literal(t *testing.T) {
 	var engine *Engine
 	var formula *f1Formula.Formula
@@ -259,6 +282,223 @@ func TestArithOfLiterals(t *testing.T) {
 	}
 }
 
+func TestPrefixOperators(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=-B2*3`) // B2 = 10
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r+30) > EPSILON {
+		t.Errorf("Expected: -30\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=1 + -2`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r+1) > EPSILON {
+		t.Errorf("Expected: -1\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=IF(-5 < 0, --5, 0)`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-5) > EPSILON {
+		t.Errorf("Expected: 5\tActual: %v", result)
+	}
+}
+
+func TestExponentOperator(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=2^3*4`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-32) > EPSILON {
+		t.Errorf("Expected: 32\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=2^3^2`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-64) > EPSILON {
+		t.Errorf("Expected: 64\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=(1+0.25)^-2`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-0.64) > EPSILON {
+		t.Errorf("Expected: 0.64\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=2^3 = POWER(2, 3)`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(bool); !ok || r != true {
+		t.Errorf("Expected: true\tActual: %v", result)
+	}
+}
+
+func TestConcatOperator(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`="Plan "&B2`) // B2 = 10
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(string); !ok || r != "Plan 10" {
+		t.Errorf("Expected: Plan 10\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=1.5&"-"&2*3`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(string); !ok || r != "1.5-6" {
+		t.Errorf("Expected: 1.5-6\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`="Rate "&1.1*3&"|"&(0.1+0.2)&""`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(string); !ok || r != "Rate 3.3|0.3" {
+		t.Errorf("Expected: Rate 3.3|0.3\tActual: %v", result)
+	}
+}
+
+func TestPercentOperator(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=B2*15%`) // B2 = 10
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-1.5) > EPSILON {
+		t.Errorf("Expected: 1.5\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=50%^2`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-0.25) > EPSILON {
+		t.Errorf("Expected: 0.25\tActual: %v", result)
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=#N/A`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrNA {
+		t.Errorf("Expected: #N/A\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=1 + #REF! * 2`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrRef {
+		t.Errorf("Expected: #REF!\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`="Plan " & -#NUM!`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrNum {
+		t.Errorf("Expected: #NUM!\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`="abc" * 2`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrValue {
+		t.Errorf("Expected: #VALUE!\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`="3" * 2`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-6) > EPSILON {
+		t.Errorf("Expected: 6\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=IFERROR(#N/A, 5)`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-5) > EPSILON {
+		t.Errorf("Expected: 5\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=VLOOKUP(99, Discounts!A2:B6, 2, 0)`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrNA {
+		t.Errorf("Expected: #N/A\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=IFERROR(VLOOKUP(99, Discounts!A2:B6, 2, 0), "None")`)
+	result, _ = engine.EvalFormula(formula)
+	if result != "None" {
+		t.Errorf("Expected: None\tActual: %v", result)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	for _, formulaText := range []string{
+		`=1/0`,
+		`=10 / (5 - 5)`,
+		`=1 + 1/0`,
+		`=-(1/0)`,
+		`=1/0 * 2`,
+		`=(1/0)^2`,
+		`=0^-1`,
+		`=1/0%`,
+		`="Total: " & 1/0`,
+		`=1/0 > 1`,
+		`=SUM(1/0)`,
+		`=SUM(1, 1/0)`,
+		`=FLOOR(1/0)`,
+		`=POWER(1/0, 2)`,
+		`=OR(1/0, 1)`,
+		`=IF(1/0, 1, 2)`,
+		`=IF(TRUE(), 1/0, 2)`,
+	} {
+		engine = NewEngine(xlFile)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != funs.ErrDiv0 {
+			t.Errorf("%s Expected: #DIV/0!\tActual: %v", formulaText, result)
+		}
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=IFERROR(1/0, 0)`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || r != 0 {
+		t.Errorf("Expected: 0\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=IF(FALSE(), 1/0, 2)`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || r != 2 {
+		t.Errorf("Expected: 2\tActual: %v", result)
+	}
+}
+
 func TestLogicalOperators(t *testing.T) {
 	var engine *Engine
 	var formula *f1Formula.Formula
@@ -305,6 +545,73 @@ func TestLogicalOperators(t *testing.T) {
 	if r, ok := result.(bool); !ok || r != true {
 		t.Errorf("Expected: true\tActual: %v", result)
 	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=5 <> 1`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(bool); !ok || r != true {
+		t.Errorf("Expected: true\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`="hello" <> "hello"`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(bool); !ok || r != false {
+		t.Errorf("Expected: false\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=B2 + 1 > 10`) // B2 = 10
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(bool); !ok || r != true {
+		t.Errorf("Expected: true\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=2 * 3 = 3 + 3`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(bool); !ok || r != true {
+		t.Errorf("Expected: true\tActual: %v", result)
+	}
+}
+
+func TestMixedTypeComparisons(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	expectations := map[string]bool{
+		`=1 < "a"`:            true,
+		`=1000 > "a"`:         false,
+		`=1 = "1"`:            false,
+		`=1 <> "1"`:           true,
+		`="a" < (1=1)`:        true,
+		`=(1=1) > 1000`:       true,
+		`=(1=1) > (1=2)`:      true,
+		`="ABC" = "abc"`:      true,
+		`="b" > "A"`:          true,
+		`="apple" <= "Apple"`: true,
+		`=Z99 = 0`:            true,
+		`=Z99 = ""`:           true,
+		`=Z99 = (1=2)`:        true,
+		`=Z99 < 1`:            true,
+		`=Discounts!E2 > B2`:  true, // "Cheap" vs 10
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(xlFile)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if r, ok := result.(bool); !ok || r != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=#N/A = "a"`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrNA {
+		t.Errorf("Expected: #N/A\tActual: %v", result)
+	}
 }
 
 func TestSimpleCellRef(t *testing.T) {
@@ -394,6 +701,27 @@ func TestFunOfLiteral(t *testing.T) {
 	}
 }
 
+func TestNumericArguments(t *testing.T) {
+	expectations := map[string]interface{}{
+		`=FLOOR(TRUE)`:                           1.0,
+		`=FLOOR("2.5")`:                          2.0,
+		`=FLOOR("x")`:                            funs.ErrValue,
+		`=FLOOR(1/0)`:                            funs.ErrDiv0,
+		`=ROUND(1.25,TRUE)`:                      1.3,
+		`=ROUND("1.5",0)`:                        2.0,
+		`=ROUND(1.5,"x")`:                        funs.ErrValue,
+		`=MATCH(1,{1,2},FALSE)=MATCH(1,{1,2},0)`: true,
+		`=MATCH(1,{1,2},TRUE)=MATCH(1,{1,2},1)`:  true,
+		`=MATCH(1,{1,2},"x")`:                    funs.ErrValue,
+	}
+	for formulaText, expected := range expectations {
+		engine := NewEngine(xlFile)
+		if result, _ := engine.EvalFormula(f1Formula.NewFormula(formulaText)); result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+}
+
 func TestSumOfRefs(t *testing.T) {
 	var engine *Engine
 	var formula *f1Formula.Formula
@@ -428,6 +756,47 @@ func TestSumOfRefs(t *testing.T) {
 	}
 }
 
+func TestArrayLiterals(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=SUM({1,2,3})`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-6) > EPSILON {
+		t.Errorf("Expected: 6\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=SUM({1;2;3}, {1,2;3,-4})`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || math.Abs(r-8) > EPSILON {
+		t.Errorf("Expected: 8\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=VLOOKUP(150, {0,"Low";100,"High"}, 2, 1)`)
+	result, _ = engine.EvalFormula(formula)
+	if result != "High" {
+		t.Errorf("Expected: High\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=COUNTIF({1,2,1}, 1)`)
+	result, _ = engine.EvalFormula(formula)
+	if r, ok := result.(float64); !ok || r != 2 {
+		t.Errorf("Expected: 2\tActual: %v", result)
+	}
+
+	engine = NewEngine(xlFile)
+	formula = f1Formula.NewFormula(`=SUM({1,#N/A})`)
+	result, _ = engine.EvalFormula(formula)
+	if result != funs.ErrNA {
+		t.Errorf("Expected: #N/A\tActual: %v", result)
+	}
+}
+
 func TestSimpleIf(t *testing.T) {
 	var engine *Engine
 	var formula *f1Formula.Formula
@@ -460,6 +829,21 @@ func TestSimpleIf(t *testing.T) {
 	if math.Abs(result.(float64)-6) > EPSILON {
 		t.Errorf("Expected: 6\tActual: %v", result)
 	}
+
+	// Omitted arguments are blank, unlike an empty text
+	expectations := map[string]interface{}{
+		`=IF(1,,2)`:   float64(0),
+		`=IF(0,2,)`:   float64(0),
+		`=IF(1,"",2)`: "",
+		`=IF(1,,2)+5`: float64(5),
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(xlFile)
+		result, _ = engine.EvalFormula(f1Formula.NewFormula(formulaText))
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
 }
 
 func TestArithIf(t *testing.T) {
@@ -529,6 +913,520 @@ func TestBooleanIf(t *testing.T) {
 	}
 }
 
+func TestBooleanLiterals(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	expectations := map[string]interface{}{
+		`=TRUE`:                                  true,
+		`=IF(B2=10, TRUE, FALSE)`:                true, // B2 = 10
+		`=IF(B2=TRUE, 1, 0)`:                     0.0,
+		`=AND(TRUE, 1)`:                          true,
+		`=OR(FALSE, FALSE)`:                      false,
+		`=OR(TRUE(), 0)`:                         true,
+		`=TRUE + 1`:                              2.0,
+		`=FALSE & "!"`:                           "FALSE!",
+		`=VLOOKUP(3, Discounts!A2:B6, 2, FALSE)`: 2.5,
+		`=VLOOKUP(150, {0,"Low";100,"High"}, 2, TRUE)`:      "High",
+		`=VLOOKUP(TRUE, {FALSE,"No";TRUE,"Yes"}, 2, FALSE)`: "Yes",
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(xlFile)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+}
+
+func TestAbsoluteReferences(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	expectations := map[string]interface{}{
+		`=$B$2`:                                  10.0,
+		`=$B$2 + B$2 + $B2`:                      30.0,
+		`=SUM($B$2:$D2)`:                         34.0,
+		`=SUM(D2:B2)`:                            34.0,
+		`=Input!$C$2`:                            11.0,
+		`=VLOOKUP(3, Discounts!$A$2:$B$6, 2, 0)`: 2.5,
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(xlFile)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+
+	engine = NewEngine(xlFile)
+	engine.EvalFormula(f1Formula.NewFormula(`=SUM($B$2:$D$2) + SUM(Input!B2:D2)`))
+	if len(engine.cache) != 1 {
+		t.Errorf("Expected: 1 cached range\tActual: %v", engine.cache)
+	}
+}
+
+func TestQuotedSheetNames(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	workbook := xlsx.NewFile()
+	sheet, _ := workbook.AddSheet("Input")
+	sheet.Cell(0, 0).SetFloat(1)
+	sheet, _ = workbook.AddSheet("Rate Table")
+	sheet.Cell(1, 1).SetFloat(0.25)
+	sheet.Cell(2, 1).SetFloat(0.5)
+	sheet, _ = workbook.AddSheet("Bob's")
+	sheet.Cell(0, 0).SetFloat(4)
+
+	expectations := map[string]interface{}{
+		`='Rate Table'!B2`:             0.25,
+		`=SUM('Rate Table'!B2:B3)`:     0.75,
+		`='Bob''s'!A1 * A1`:            4.0,
+		`='Missing'!A1`:                funs.ErrRef,
+		`=SUM(Missing!A1:A2)`:          funs.ErrRef,
+		`=IFERROR(Missing!A1, "none")`: "none",
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(workbook)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+
+	engine = NewEngine(workbook)
+	if _, err := engine.GetCell(`'Rate Table'!B3`); err != nil {
+		t.Errorf("Expected: B3\tActual: %v", err)
+	}
+	if _, err := engine.GetCell(`Missing!B3`); err != funs.ErrRef {
+		t.Errorf("Expected: %v\tActual: %v", funs.ErrRef, err)
+	}
+}
+
+func TestWholeColumnAndRowReferences(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	expectations := map[string]interface{}{
+		`=VLOOKUP(3, Discounts!A:B, 2, FALSE)`: 2.5,
+		`=VLOOKUP(3, Discounts!$A:$B, 2, 0)`:   2.5,
+		`=SUM(Input!2:2)`:                      34.0,
+		`=SUM(Input!B:B)`:                      97.32, // B1:B11
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(xlFile)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+
+	engine = NewEngine(xlFile)
+	cellRange, err := engine.GetRange("Discounts!A:B")
+	if err != nil {
+		t.Error(err)
+	} else if sheet := xlFile.Sheet["Discounts"]; cellRange.rowCount != sheet.MaxRow || cellRange.colCount != 2 {
+		t.Errorf("Expected: %dx2\tActual: %dx%d", sheet.MaxRow, cellRange.rowCount, cellRange.colCount)
+	}
+}
+
+func TestDefinedNames(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	expectations := map[string]interface{}{
+		`=Age + 1`:                               11.0,
+		`=age * Rate`:                            0.5,
+		`=VLOOKUP(3, RateTable, 2, FALSE)`:       2.5,
+		`=SUM(RateTable) = SUM(Discounts!A2:B6)`: true,
+		`=Discounts!Age`:                         11.0,
+		`=Input!Age`:                             funs.ErrName,
+		`=Unknown + 1`:                           funs.ErrName,
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(xlFile)
+		engine.DefineName("Age", "Input!$B$2", "")
+		engine.DefineName("Rate", "=0.05", "")
+		engine.DefineName("RateTable", "Discounts!$A$2:$B$6", "")
+		engine.DefineName("Age", "Input!$C$2", "Discounts")
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+
+	// Sheet scoped names hide workbook names while on their sheet
+	engine = NewEngine(xlFile)
+	engine.DefineName("Age", "Input!$B$2", "")
+	engine.DefineName("Age", "Input!$C$2", "Discounts")
+	engine.activeSheet = xlFile.Sheet["Discounts"]
+	result, _ = engine.EvalFormula(f1Formula.NewFormula(`=Age`))
+	if result != 11.0 {
+		t.Errorf("Expected: 11\tActual: %v", result)
+	}
+}
+
+func TestExecuteDefinedNames(t *testing.T) {
+	workbook := xlsx.NewFile()
+	sheet, _ := workbook.AddSheet("Input")
+	sheet.Cell(0, 0).SetFloat(1)
+	sheet.Cell(0, 1).SetFormula("Age*2")
+	sheet.Cell(1, 1).SetFormula("Age*3")
+
+	engine := NewEngine(workbook)
+	engine.DefineName("Age", "Input!$A$1", "")
+	engine.DefineName("Premium", "Input!$B$1", "")
+	engine.DefineName("Premiums", "Input!$B$1:$B$2", "")
+
+	inputs := map[string]string{
+		"Age": "30",
+	}
+	outputs := &map[string]OutParam{
+		"Premium":  NewOutParam("string"),
+		"Premiums": NewOutParam("$ref"),
+	}
+	if err := engine.Execute(inputs, outputs); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if (*outputs)["Premium"].Value != "60" {
+		t.Errorf("Expected: 60\tActual: %v", (*outputs)["Premium"].Value)
+	}
+	if values, ok := (*outputs)["Premiums"].Value.([]string); !ok || len(values) != 2 || values[1] != "90" {
+		t.Errorf("Expected: [60 90]\tActual: %v", (*outputs)["Premiums"].Value)
+	}
+
+	// Values computed with what a name stood for before are not reused
+	formula := f1Formula.NewFormula(`=Input!B1 + SUM(Input!B1:B2)`)
+	if result, _ := engine.EvalFormula(formula); result != 210.0 {
+		t.Errorf("Expected: 210\tActual: %v", result)
+	}
+	sheet.Cell(1, 0).SetFloat(5)
+	engine.DefineName("Age", "Input!$A$2", "")
+	if result, _ := engine.EvalFormula(formula); result != 35.0 {
+		t.Errorf("Expected: 35\tActual: %v", result)
+	}
+}
+
+func Test3DReferences(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	workbook := xlsx.NewFile()
+	for i, name := range []string{"Jan", "Feb", "Mar", "Summary"} {
+		sheet, _ := workbook.AddSheet(name)
+		sheet.Cell(4, 1).SetFloat(float64(i + 1))
+	}
+	workbook.Sheet["Feb"].Cell(5, 1).SetFormula("B5*10")
+
+	expectations := map[string]interface{}{
+		`=SUM(Jan:Mar!B5)`:            6.0,
+		`=SUM(Mar:Jan!$B$5)`:          6.0,
+		`=SUM(Jan:Feb!B5:B6)`:         23.0,
+		`=SUM(Feb:Summary!B5) + 1`:    10.0,
+		`=COUNTIF(Jan:Summary!B5, 2)`: 1.0,
+		`=SUM(Jan:Dec!B5)`:            funs.ErrRef,
+		`=Jan!B5 + Mar!B6`:            1.0,
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(workbook)
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+}
+
+func TestRangeOperators(t *testing.T) {
+	var engine *Engine
+	var formula *f1Formula.Formula
+	var result interface{}
+
+	// Every cell holds row*10 + column, e.g. C3 is 33
+	workbook := xlsx.NewFile()
+	sheet, _ := workbook.AddSheet("Input")
+	for row := 0; row < 9; row++ {
+		for col := 0; col < 4; col++ {
+			sheet.Cell(row, col).SetFloat(float64((row+1)*10 + col + 1))
+		}
+	}
+	sheet, _ = workbook.AddSheet("Other")
+	sheet.Cell(0, 0).SetFloat(100)
+
+	expectations := map[string]interface{}{
+		`=SUM((A1:A5,C1:C5))`:       320.0,
+		`=SUM(B1:D5 C3:C9)`:         129.0,
+		`=B2:D2 C1:C9`:              23.0,
+		`=A1:A2 C1:C2`:              funs.ErrNull,
+		`=Nope!A1:A2 A1`:            funs.ErrRef,
+		`=SUM(A1:Nope!B2)`:          funs.ErrRef,
+		`=SUM((A1,Nope!B2))`:        funs.ErrRef,
+		`=SUM(A1:(B2))`:             66.0,
+		`=SUM(Input!B2:Input!D2)`:   69.0,
+		`=SUM(Input!B2:(Input!D2))`: 69.0,
+		`=SUM(Start:B2)`:            66.0,
+		`=SUM((A1,B1) A1:A2)`:       11.0,
+		`=SUM(1:2 A:A)`:             32.0,
+		`=SUM((A1,Other!A1))`:       111.0,
+		`=SUM((A1,2))`:              funs.ErrValue,
+		`=SUM((A1,Unknown))`:        funs.ErrName,
+		`=IFERROR(A1 B2, "none")`:   "none",
+	}
+	for formulaText, expected := range expectations {
+		engine = NewEngine(workbook)
+		engine.DefineName("Start", "Input!$A$1", "")
+		formula = f1Formula.NewFormula(formulaText)
+		result, _ = engine.EvalFormula(formula)
+		if result != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", formulaText, expected, result)
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &output
+	logger.SetLevel(logrus.DebugLevel)
+
+	engine := NewEngine(xlFile, WithLogger(logger))
+	engine.EvalFormula(f1Formula.NewFormula(`=Input!B2 + NOPE(1)`))
+	if result := output.String(); !strings.Contains(result, "Function not exists: NOPE") {
+		t.Errorf("Expected: Function not exists: NOPE\tActual: %s", result)
+	}
+	if result := output.String(); !strings.Contains(result, "level=debug") {
+		t.Errorf("Expected: level=debug\tActual: %s", result)
+	}
+
+	output.Reset()
+	logger.SetLevel(logrus.WarnLevel)
+	engine = NewEngine(xlFile, WithLogger(logrus.NewEntry(logger)))
+	engine.EvalFormula(f1Formula.NewFormula(`=Input!B2 + 1`))
+	if output.Len() != 0 {
+		t.Errorf("Expected: no output\tActual: %s", output.String())
+	}
+
+	if _, ok := NewEngine(xlFile).logger.(nopLogger); !ok {
+		t.Errorf("Expected: nopLogger\tActual: %T", NewEngine(xlFile).logger)
+	}
+}
+
+func TestNodeError(t *testing.T) {
+	engine := NewEngine(xlFile)
+	result, _ := engine.EvalFormula(f1Formula.NewFormula(`=Input!B2 + NOPE(1)`))
+	if result != funs.ErrName {
+		t.Errorf("Expected: #NAME?\tActual: %v", result)
+	}
+	nodeErrors := engine.LastErrors()
+	if len(nodeErrors) != 1 || nodeErrors[0].Span != (f1Formula.Span{Start: 12, End: 19}) ||
+		nodeErrors[0].Error() != "Function not exists: NOPE at 12-19" {
+		t.Errorf("Expected: Function not exists: NOPE at 12-19\tActual: %v", nodeErrors)
+	}
+
+	expectations := []struct {
+		formula  string
+		expected interface{}
+		failures string
+	}{
+		{`=IFERROR(NOPE(1),0)`, float64(0), "Function not exists: NOPE at 9-16"},
+		{`=SUM(1,2,3)`, funs.ErrValue, "Invalid fun SUM with 3 arguments at 1-11"},
+		{`=1 + IFERROR(SUM(1,2,3),7)`, float64(8), "Invalid fun SUM with 3 arguments at 13-23"},
+		{`=1 + 2`, float64(3), ""},
+	}
+	for _, expectation := range expectations {
+		result, _ := engine.EvalFormula(f1Formula.NewFormula(expectation.formula))
+		if result != expectation.expected {
+			t.Errorf("%s Expected: %v\tActual: %v", expectation.formula, expectation.expected, result)
+		}
+		texts := []string{}
+		for _, err := range engine.LastErrors() {
+			texts = append(texts, err.Error())
+		}
+		if failures := strings.Join(texts, ", "); failures != expectation.failures {
+			t.Errorf("%s Expected: %s\tActual: %s", expectation.formula, expectation.failures, failures)
+		}
+	}
+
+	// Failures in the formulas of cells read are not the caller's to underline
+	workbook := xlsx.NewFile()
+	sheet, _ := workbook.AddSheet("Input")
+	sheet.Cell(0, 0).SetFormula("NOPE(1)")
+	engine = NewEngine(workbook)
+	if result, _ := engine.EvalFormula(f1Formula.NewFormula(`=A1`)); result != funs.ErrName || len(engine.LastErrors()) != 0 {
+		t.Errorf("Expected: #NAME? and no errors\tActual: %v %v", result, engine.LastErrors())
+	}
+}
+
+func TestPrecedents(t *testing.T) {
+	engine := NewEngine(xlFile)
+	expectations := map[string]string{
+		"Input!B2":  "",
+		"Input!B3":  "Discounts!E2",
+		"Input!B9":  "Input!B2 Input!B6 Input!B7",
+		"Input!B11": "Input!B9:B10",
+	}
+	for cellID, expected := range expectations {
+		precedents, err := engine.Precedents(cellID)
+		if err != nil {
+			t.Errorf("%s Expected: %s\tActual: %v", cellID, expected, err)
+			continue
+		}
+
+		texts := make([]string, len(precedents))
+		for i, precedent := range precedents {
+			texts[i] = precedent.String()
+		}
+		if result := strings.Join(texts, " "); result != expected {
+			t.Errorf("%s Expected: %s\tActual: %s", cellID, expected, result)
+		}
+	}
+
+	for _, cellID := range []string{"Input!B9:B10", "Nowhere!A1", "Nothing"} {
+		if _, err := engine.Precedents(cellID); err == nil {
+			t.Errorf("%s Expected: error\tActual: nil", cellID)
+		}
+	}
+}
+
+func TestDependents(t *testing.T) {
+	engine := NewEngine(xlFile)
+	engine.DefineName("Price", "Input!$B$2", "")
+	expectations := map[string]string{
+		"Input!B2":        "Input!B9",
+		"Price":           "Input!B9",
+		"Input!$B$9":      "Input!B10 Input!B11",
+		"Input!B10":       "Input!B11",
+		"Input!B11":       "",
+		"Input!A1":        "",
+		"Discounts!E2:E4": "Input!B3 Input!C3 Input!D3",
+		"Input!B:B":       "Input!B9 Input!B10 Input!B11",
+	}
+	for cellID, expected := range expectations {
+		dependents, err := engine.Dependents(cellID)
+		if result := strings.Join(dependents, " "); err != nil || result != expected {
+			t.Errorf("%s Expected: %s\tActual: %s %v", cellID, expected, result, err)
+		}
+	}
+
+	if _, err := engine.Dependents("Nowhere!A1"); err == nil {
+		t.Errorf("Expected: error\tActual: nil")
+	}
+}
+
+func TestTransitiveDependencies(t *testing.T) {
+	engine := NewEngine(xlFile)
+	dependents, _ := engine.TransitiveDependents("Input!B2")
+	if result := strings.Join(dependents, " "); result != "Input!B9 Input!B10 Input!B11" {
+		t.Errorf("Expected: Input!B9 Input!B10 Input!B11\tActual: %s", result)
+	}
+
+	precedents, _ := engine.TransitivePrecedents("Input!B11")
+	if result := strings.Join(precedents, " "); result != "Input!B9 Input!B10" {
+		t.Errorf("Expected: Input!B9 Input!B10\tActual: %s", result)
+	}
+
+	order, err := engine.TopologicalOrder()
+	expected := "Input!B3 Input!C3 Input!D3 Input!B9 Input!B10 Input!B11"
+	if result := strings.Join(order, " "); err != nil || result != expected {
+		t.Errorf("Expected: %s\tActual: %s %v", expected, result, err)
+	}
+}
+
+func TestFormulaAreas(t *testing.T) {
+	engine := NewEngine(xlFile)
+	engine.DefineName("Rate", "Input!$B$6", "")
+	engine.DefineName("Tax", "Rate*2+Tax", "")
+	engine.DefineName("Rate", "Discounts!$A$1", "Discounts")
+
+	expectations := map[string]string{
+		"=Tax+B2":                     "Input!B6 Input!B2",
+		"=Discounts!Rate+Rate":        "Discounts!A1 Input!B6",
+		"=SUM(Input:Discounts!C1:C2)": "Input!C1:C2 Discounts!C1:C2",
+		"=Nothing+1":                  "",
+	}
+	for formulaText, expected := range expectations {
+		areas := engine.formulaAreas(formulaText, "Input", map[string]bool{})
+		texts := make([]string, len(areas))
+		for i, area := range areas {
+			texts[i] = area.String()
+		}
+		if result := strings.Join(texts, " "); result != expected {
+			t.Errorf("%s Expected: %s\tActual: %s", formulaText, expected, result)
+		}
+	}
+}
+
+func TestCircularReferences(t *testing.T) {
+	engine := NewEngine(xlFile)
+	graph := newGraph()
+	graph.add(cell{sheet: "Loop", row: 0, col: 0}, engine.formulaAreas("=A2+1", "Loop", map[string]bool{}))
+	graph.add(cell{sheet: "Loop", row: 1, col: 0}, engine.formulaAreas("=SUM(A1:A1)", "Loop", map[string]bool{}))
+	graph.index()
+	engine.graph = graph
+
+	if _, err := engine.TopologicalOrder(); err == nil || !strings.Contains(err.Error(), "Loop!A1, Loop!A2") {
+		t.Errorf("Expected: Circular reference among Loop!A1, Loop!A2\tActual: %v", err)
+	}
+}
+
+func TestIncrementalRecalculation(t *testing.T) {
+	localFile, _ := xlsx.OpenFile("../testdocs/formula1-x1.xlsx")
+	engine := NewEngine(localFile)
+
+	expectations := []struct {
+		input    string
+		expected float64
+	}{
+		{"10", 40.66},
+		{"20", 83.46},
+		{"10", 40.66},
+	}
+	for _, expectation := range expectations {
+		outputs := &map[string]OutParam{
+			"Input!B11": NewOutParam("string"),
+		}
+		engine.Execute(map[string]string{"Input!B2": expectation.input}, outputs)
+		result, _ := strconv.ParseFloat((*outputs)["Input!B11"].Value.(string), 64)
+		if math.Abs(result-expectation.expected) > EPSILON {
+			t.Errorf("B2=%s Expected: %v\tActual: %v", expectation.input, expectation.expected, (*outputs)["Input!B11"].Value)
+		}
+	}
+
+	// Cells not depending on Input!B2 stay cached
+	engine.EvalFormula(f1Formula.NewFormula(`=Input!B3 & Input!B11`))
+	engine.SetCell("Input!B2", "30")
+	for _, key := range []string{"Input!B9", "Input!B10", "Input!B9:B10", "Input!B11"} {
+		if _, ok := engine.cache[key]; ok {
+			t.Errorf("Expected: %s invalidated\tActual: %v", key, engine.cache)
+		}
+	}
+	if _, ok := engine.cache["Input!B3"]; !ok {
+		t.Errorf("Expected: Input!B3 cached\tActual: %v", engine.cache)
+	}
+
+	// A formula replaced by a value no longer depends on anything
+	engine.SetCell("Input!B9", "1")
+	if dependents, _ := engine.Dependents("Input!B2"); len(dependents) != 0 {
+		t.Errorf("Expected: no dependents\tActual: %v", dependents)
+	}
+	result, _ := engine.EvalFormula(f1Formula.NewFormula(`=Input!B11`))
+	if math.Abs(result.(float64)-1.07) > EPSILON {
+		t.Errorf("Expected: 1.07\tActual: %v", result)
+	}
+}
+
 func TestAdvancedFunctions(t *testing.T) {
 	var engine *Engine
 	var formula *f1Formula.Formula
@@ -1,12 +1,29 @@
 package engine
 
+import (
+	"fmt"
+
+	f1F "github.com/khanhhua/formula1/formula"
+)
+
 type EngineError struct {
 	error
 	message string
 }
 
 func Error(message string) EngineError {
-  return EngineError {
-    message: message,
-  }
+	return EngineError{
+		message: message,
+	}
+}
+
+// NodeError Error raised evaluating a node of a formula. Span locates the
+// node in the formula text, e.g. to underline it
+type NodeError struct {
+	Message string
+	Span    f1F.Span
+}
+
+func (err *NodeError) Error() string {
+	return fmt.Sprintf("%s at %d-%d", err.Message, err.Span.Start, err.Span.End)
 }
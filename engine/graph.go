@@ -0,0 +1,648 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	f1F "github.com/khanhhua/formula1/formula"
+)
+
+// indexWidth Ranges up to this many columns wide are indexed under each of
+// their columns, wider ones such as whole rows are checked one by one
+const indexWidth = 64
+
+// cell A single cell of the workbook
+type cell struct {
+	sheet string
+	row   int
+	col   int
+}
+
+// cellOf Top left cell of a reference
+func cellOf(ref f1F.Reference) cell {
+	return cell{sheet: ref.Sheet, row: ref.From.Row, col: ref.From.Col}
+}
+
+// reference Reference to the cell alone
+func (c cell) reference() f1F.Reference {
+	at := f1F.CellRef{Col: c.col, Row: c.row}
+	return f1F.Reference{Sheet: c.sheet, From: at, To: at}
+}
+
+// in Whether the cell lies in area
+func (c cell) in(area f1F.Reference) bool {
+	return c.sheet == area.Sheet &&
+		c.row >= area.From.Row && c.row <= area.To.Row &&
+		c.col >= area.From.Col && c.col <= area.To.Col
+}
+
+// String Sheet qualified address, e.g. Input!B9
+func (c cell) String() string {
+	return c.reference().String()
+}
+
+// cellSet Cells looked up by the areas holding them
+type cellSet struct {
+	// cols Columns holding cells, ascending, by sheet
+	cols map[string][]int
+	// rows Rows of the cells, ascending, by sheet and column
+	rows map[string]map[int][]int
+}
+
+func newCellSet(cells []cell) *cellSet {
+	set := &cellSet{cols: make(map[string][]int), rows: make(map[string]map[int][]int)}
+	for _, c := range cells {
+		columns, ok := set.rows[c.sheet]
+		if !ok {
+			columns = make(map[int][]int)
+			set.rows[c.sheet] = columns
+		}
+		if _, ok := columns[c.col]; !ok {
+			set.cols[c.sheet] = append(set.cols[c.sheet], c.col)
+		}
+		columns[c.col] = append(columns[c.col], c.row)
+	}
+
+	for sheet, cols := range set.cols {
+		sort.Ints(cols)
+		for _, col := range cols {
+			sort.Ints(set.rows[sheet][col])
+		}
+	}
+	return set
+}
+
+// intersects Whether any of the cells lies in area
+func (set *cellSet) intersects(area f1F.Reference) bool {
+	cols := set.cols[area.Sheet]
+	for i := sort.SearchInts(cols, area.From.Col); i < len(cols) && cols[i] <= area.To.Col; i++ {
+		rows := set.rows[area.Sheet][cols[i]]
+		if j := sort.SearchInts(rows, area.From.Row); j < len(rows) && rows[j] <= area.To.Row {
+			return true
+		}
+	}
+	return false
+}
+
+// graph Dependencies between the cells of a workbook, read off the formulas
+// without evaluating them. Formula cells are known by their position in
+// cells, which is workbook order
+type graph struct {
+	// cells Formula cells sheet by sheet and row by row
+	cells []cell
+	// ids Position of each formula cell in cells
+	ids map[cell]int
+	// precedents Areas each formula cell reads, names and 3D references
+	// resolved to areas of a single sheet
+	precedents [][]f1F.Reference
+	// dependents Formula cells reading a single cell
+	dependents map[cell][]int
+	// sheets Formula cells and ranges read, sheet by sheet
+	sheets map[string]*sheetIndex
+}
+
+// sheetIndex Lookups within one sheet
+type sheetIndex struct {
+	// cols Columns holding formula cells, ascending
+	cols []int
+	// columns Formula cells of each column, by row
+	columns map[int][]int
+	// readers Ranges read on the sheet and the formula cell reading each
+	readers []reader
+	// narrow Readers of ranges at most indexWidth columns wide, under each
+	// column they span
+	narrow map[int]*intervals
+	// wide Readers of wider ranges
+	wide []int
+}
+
+// reader A formula cell reading a range
+type reader struct {
+	area      f1F.Reference
+	dependent int
+}
+
+// intervals Readers of ranges covering a column, found by row. lasts is a
+// segment tree whose leaves, from size on, hold the last row each reader
+// covers and whose inner nodes hold the largest last row below them
+type intervals struct {
+	// readers Positions in sheetIndex.readers, by first row
+	readers []int
+	// firsts First row covered by each reader
+	firsts []int
+	lasts  []int
+	size   int
+}
+
+func newGraph() *graph {
+	return &graph{
+		ids:        make(map[cell]int),
+		dependents: make(map[cell][]int),
+		sheets:     make(map[string]*sheetIndex),
+	}
+}
+
+// dependencyGraph Graph of the workbook, built on first use
+func (g *Engine) dependencyGraph() *graph {
+	if g.graph != nil {
+		return g.graph
+	}
+
+	graph := newGraph()
+	for _, sheet := range g.xlFile.Sheets {
+		for row, xlRow := range sheet.Rows {
+			if xlRow == nil {
+				continue
+			}
+			for col, xlCell := range xlRow.Cells {
+				if xlCell == nil || xlCell.Formula() == "" {
+					continue
+				}
+
+				areas := g.formulaAreas("="+xlCell.Formula(), sheet.Name, map[string]bool{})
+				graph.add(cell{sheet: sheet.Name, row: row, col: col}, areas)
+			}
+		}
+	}
+	graph.index()
+
+	g.graph = graph
+	return graph
+}
+
+// add Record a formula cell and the areas it reads. Cells come in workbook
+// order, index builds the lookups once all are in
+func (graph *graph) add(formulaCell cell, areas []f1F.Reference) {
+	id := len(graph.cells)
+	graph.cells = append(graph.cells, formulaCell)
+	graph.ids[formulaCell] = id
+	graph.precedents = append(graph.precedents, areas)
+
+	index := graph.sheet(formulaCell.sheet)
+	index.columns[formulaCell.col] = append(index.columns[formulaCell.col], id)
+	for _, area := range areas {
+		if area.IsRange() {
+			readers := graph.sheet(area.Sheet)
+			readers.readers = append(readers.readers, reader{area: area, dependent: id})
+		} else {
+			graph.dependents[cellOf(area)] = append(graph.dependents[cellOf(area)], id)
+		}
+	}
+}
+
+// sheet Lookups of a sheet, created on first use
+func (graph *graph) sheet(name string) *sheetIndex {
+	index, ok := graph.sheets[name]
+	if !ok {
+		index = &sheetIndex{
+			columns: make(map[int][]int),
+			narrow:  make(map[int]*intervals),
+		}
+		graph.sheets[name] = index
+	}
+	return index
+}
+
+// index Build the lookups of the sheets
+func (graph *graph) index() {
+	for _, index := range graph.sheets {
+		index.cols = index.cols[:0]
+		for col := range index.columns {
+			index.cols = append(index.cols, col)
+		}
+		sort.Ints(index.cols)
+
+		narrow := make(map[int][]int)
+		index.wide = nil
+		for position, reader := range index.readers {
+			if reader.area.To.Col-reader.area.From.Col >= indexWidth {
+				index.wide = append(index.wide, position)
+				continue
+			}
+			for col := reader.area.From.Col; col <= reader.area.To.Col; col++ {
+				narrow[col] = append(narrow[col], position)
+			}
+		}
+
+		index.narrow = make(map[int]*intervals)
+		for col, positions := range narrow {
+			index.narrow[col] = newIntervals(positions, index.readers)
+		}
+	}
+}
+
+func newIntervals(positions []int, readers []reader) *intervals {
+	sort.SliceStable(positions, func(i, j int) bool {
+		return readers[positions[i]].area.From.Row < readers[positions[j]].area.From.Row
+	})
+
+	tree := &intervals{readers: positions, firsts: make([]int, len(positions)), size: 1}
+	for tree.size < len(positions) {
+		tree.size *= 2
+	}
+	tree.lasts = make([]int, 2*tree.size)
+	for i := range tree.lasts {
+		tree.lasts[i] = -1
+	}
+	for i, position := range positions {
+		tree.firsts[i] = readers[position].area.From.Row
+		tree.lasts[tree.size+i] = readers[position].area.To.Row
+	}
+	for i := tree.size - 1; i > 0; i-- {
+		tree.lasts[i] = tree.lasts[2*i]
+		if tree.lasts[2*i+1] > tree.lasts[i] {
+			tree.lasts[i] = tree.lasts[2*i+1]
+		}
+	}
+	return tree
+}
+
+// take Report the readers covering row, taking them out of lasts, a copy of
+// the tree, so no later call reports them again. Only the first count
+// readers start at or above row. node spans leaves lo to hi
+func (tree *intervals) take(lasts []int, node int, lo int, hi int, count int, row int, found func(position int)) {
+	if lo >= count || lasts[node] < row {
+		return
+	} else if node >= tree.size {
+		lasts[node] = -1
+		found(tree.readers[node-tree.size])
+		return
+	}
+
+	middle := (lo + hi) / 2
+	tree.take(lasts, 2*node, lo, middle, count, row, found)
+	tree.take(lasts, 2*node+1, middle, hi, count, row, found)
+	lasts[node] = lasts[2*node]
+	if lasts[2*node+1] > lasts[node] {
+		lasts[node] = lasts[2*node+1]
+	}
+}
+
+// search One walk through the dependents of cells, during which each range
+// reader is reported once however many of its cells are visited
+type search struct {
+	graph *graph
+	// lasts Copies of interval trees with the readers reported taken out
+	lasts map[*intervals][]int
+	// reported Wide readers reported, by sheet
+	reported map[*sheetIndex][]bool
+}
+
+func (graph *graph) search() *search {
+	return &search{
+		graph:    graph,
+		lasts:    make(map[*intervals][]int),
+		reported: make(map[*sheetIndex][]bool),
+	}
+}
+
+// dependentsOf Report the formula cells reading c directly
+func (search *search) dependentsOf(c cell, found func(id int)) {
+	for _, id := range search.graph.dependents[c] {
+		found(id)
+	}
+
+	index, ok := search.graph.sheets[c.sheet]
+	if !ok {
+		return
+	}
+	if tree, ok := index.narrow[c.col]; ok {
+		lasts, ok := search.lasts[tree]
+		if !ok {
+			lasts = append([]int(nil), tree.lasts...)
+			search.lasts[tree] = lasts
+		}
+		count := sort.SearchInts(tree.firsts, c.row+1)
+		tree.take(lasts, 1, 0, tree.size, count, c.row, func(position int) {
+			found(index.readers[position].dependent)
+		})
+	}
+
+	if len(index.wide) == 0 {
+		return
+	}
+	reported, ok := search.reported[index]
+	if !ok {
+		reported = make([]bool, len(index.readers))
+		search.reported[index] = reported
+	}
+	for _, position := range index.wide {
+		if !reported[position] && c.in(index.readers[position].area) {
+			reported[position] = true
+			found(index.readers[position].dependent)
+		}
+	}
+}
+
+// dependentsOfArea Report the formula cells reading any cell of area
+// directly. Goes through every reader, meant for the odd range query
+func (graph *graph) dependentsOfArea(area f1F.Reference, found func(id int)) {
+	for c, ids := range graph.dependents {
+		if c.in(area) {
+			for _, id := range ids {
+				found(id)
+			}
+		}
+	}
+	if index, ok := graph.sheets[area.Sheet]; ok {
+		for _, reader := range index.readers {
+			if _, ok := reader.area.Intersect(area); ok {
+				found(reader.dependent)
+			}
+		}
+	}
+}
+
+// cellsIn Report the formula cells inside area, column by column
+func (graph *graph) cellsIn(area f1F.Reference, found func(id int)) {
+	index, ok := graph.sheets[area.Sheet]
+	if !ok {
+		return
+	}
+
+	for i := sort.SearchInts(index.cols, area.From.Col); i < len(index.cols) && index.cols[i] <= area.To.Col; i++ {
+		ids := index.columns[index.cols[i]]
+		start := sort.Search(len(ids), func(j int) bool {
+			return graph.cells[ids[j]].row >= area.From.Row
+		})
+		for _, id := range ids[start:] {
+			if graph.cells[id].row > area.To.Row {
+				break
+			}
+			found(id)
+		}
+	}
+}
+
+// precedentsOf Report the formula cells formula cell id reads directly
+func (graph *graph) precedentsOf(id int, found func(id int)) {
+	for _, area := range graph.precedents[id] {
+		graph.cellsIn(area, found)
+	}
+}
+
+// dependentsOfRef Formula cells reading any cell of ref directly
+func (graph *graph) dependentsOfRef(ref f1F.Reference) []int {
+	found := make([]bool, len(graph.cells))
+	mark := func(id int) { found[id] = true }
+	if ref.IsRange() {
+		graph.dependentsOfArea(ref, mark)
+	} else {
+		graph.search().dependentsOf(cellOf(ref), mark)
+	}
+	return marked(found)
+}
+
+// dependentsClosure Formula cells depending on any cell of ref, directly or
+// through other formulas. ref itself is left out unless it is reached again
+func (graph *graph) dependentsClosure(ref f1F.Reference) []int {
+	found := make([]bool, len(graph.cells))
+	queue := []int{}
+	visit := func(id int) {
+		if !found[id] {
+			found[id] = true
+			queue = append(queue, id)
+		}
+	}
+
+	search := graph.search()
+	if ref.IsRange() {
+		graph.dependentsOfArea(ref, visit)
+	} else {
+		search.dependentsOf(cellOf(ref), visit)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		search.dependentsOf(graph.cells[id], visit)
+	}
+	return marked(found)
+}
+
+// precedentsClosure Formula cells the formula cells of ref read, directly
+// or through other formulas
+func (graph *graph) precedentsClosure(ref f1F.Reference) []int {
+	found := make([]bool, len(graph.cells))
+	queue := []int{}
+	visit := func(id int) {
+		if !found[id] {
+			found[id] = true
+			queue = append(queue, id)
+		}
+	}
+
+	graph.cellsIn(ref, func(id int) {
+		graph.precedentsOf(id, visit)
+	})
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		graph.precedentsOf(id, visit)
+	}
+	return marked(found)
+}
+
+// topologicalOrder Formula cells ordered so each comes after the formula
+// cells it reads. Fails on circular references, naming the cells of the
+// first circle found
+func (graph *graph) topologicalOrder() (order []int, err error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(graph.cells))
+	path := []int{}
+
+	var visit func(id int)
+	visit = func(id int) {
+		if err != nil || state[id] == visited {
+			return
+		} else if state[id] == visiting {
+			circle := make([]bool, len(graph.cells))
+			for i := len(path) - 1; i >= 0 && !circle[id]; i-- {
+				circle[path[i]] = true
+			}
+			err = fmt.Errorf("Circular reference among %s", strings.Join(graph.keys(marked(circle)), ", "))
+			return
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+		graph.precedentsOf(id, visit)
+		path = path[:len(path)-1]
+		state[id] = visited
+		order = append(order, id)
+	}
+
+	for id := range graph.cells {
+		if visit(id); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// keys Addresses of formula cells
+func (graph *graph) keys(ids []int) []string {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = graph.cells[id].String()
+	}
+	return keys
+}
+
+// marked Positions set in found, ascending
+func marked(found []bool) []int {
+	ids := []int{}
+	for id, ok := range found {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// formulaAreas Areas a formula on sheet reads, following defined names.
+// names holds the names already being followed, against circular names.
+// Formulas which do not parse read nothing
+func (g *Engine) formulaAreas(formulaString string, sheet string, names map[string]bool) (areas []f1F.Reference) {
+	formula, err := g.compile(formulaString)
+	if err != nil {
+		g.logger.Warnf("Could not parse %s on %s. Reason: %v", formulaString, sheet, err)
+		return
+	}
+
+	for _, dependency := range formula.Dependencies(sheet) {
+		if !dependency.IsName() {
+			areas = append(areas, g.sheetAreas(dependency.Reference)...)
+			continue
+		}
+
+		key, refersTo, ok := g.lookupName(dependency.Reference.Sheet, sheet, dependency.Name)
+		if !ok || names[key] {
+			continue
+		}
+		names[key] = true
+		if ref, err := f1F.ParseReference(refersTo); err == nil {
+			if ref.Sheet == "" {
+				ref.Sheet = sheet
+			}
+			areas = append(areas, g.sheetAreas(ref)...)
+		} else {
+			areas = append(areas, g.formulaAreas("="+refersTo, sheet, names)...)
+		}
+	}
+	return
+}
+
+// lookupName Lookup key and formula text of a name used on sheet, qualified
+// with qualifier when not empty
+func (g *Engine) lookupName(qualifier string, sheet string, name string) (key string, refersTo string, ok bool) {
+	if qualifier != "" {
+		key = nameKey(qualifier, name)
+		refersTo, ok = g.names[key]
+		return
+	}
+
+	for _, scope := range []string{sheet, ""} {
+		key = nameKey(scope, name)
+		if refersTo, ok = g.names[key]; ok {
+			return
+		}
+	}
+	return
+}
+
+// sheetAreas A reference split into one area per sheet, for 3D references
+// such as Jan:Dec!B5. Nil when either end of the run of sheets is missing
+func (g *Engine) sheetAreas(ref f1F.Reference) []f1F.Reference {
+	if ref.LastSheet == "" {
+		return []f1F.Reference{ref}
+	}
+
+	first, last := -1, -1
+	for i, sheet := range g.xlFile.Sheets {
+		if sheet.Name == ref.Sheet {
+			first = i
+		}
+		if sheet.Name == ref.LastSheet {
+			last = i
+		}
+	}
+	if first < 0 || last < 0 {
+		return nil
+	} else if first > last {
+		first, last = last, first
+	}
+
+	areas := []f1F.Reference{}
+	for _, sheet := range g.xlFile.Sheets[first : last+1] {
+		area := ref
+		area.Sheet, area.LastSheet = sheet.Name, ""
+		areas = append(areas, area)
+	}
+	return areas
+}
+
+// cellReference Sheet qualified reference of a cell or range, or of a name
+// standing for one, for graph queries
+func (g *Engine) cellReference(cellID string) (ref f1F.Reference, err error) {
+	if ref, err = g.reference(cellID); err != nil {
+		return
+	}
+
+	sheet := g.sheet(ref)
+	if sheet == nil {
+		err = fmt.Errorf("No sheet for %s", cellID)
+		return
+	}
+	ref.Sheet = sheet.Name
+	return
+}
+
+// Dependents Formula cells reading any cell of cellID directly, e.g.
+// Input!B9 for Input!B2. cellID may be a cell, a range or a defined name
+func (g *Engine) Dependents(cellID string) (dependents []string, err error) {
+	var ref f1F.Reference
+	if ref, err = g.cellReference(cellID); err != nil {
+		return
+	}
+	graph := g.dependencyGraph()
+	return graph.keys(graph.dependentsOfRef(ref)), nil
+}
+
+// TransitiveDependents Formula cells affected by a change to cellID, directly
+// or through other formulas, in workbook order
+func (g *Engine) TransitiveDependents(cellID string) (dependents []string, err error) {
+	var ref f1F.Reference
+	if ref, err = g.cellReference(cellID); err != nil {
+		return
+	}
+	graph := g.dependencyGraph()
+	return graph.keys(graph.dependentsClosure(ref)), nil
+}
+
+// TransitivePrecedents Formula cells the formulas of cellID need computed
+// first, directly or through other formulas, in workbook order. Cells
+// holding plain values are left out, see Precedents for those
+func (g *Engine) TransitivePrecedents(cellID string) (precedents []string, err error) {
+	var ref f1F.Reference
+	if ref, err = g.cellReference(cellID); err != nil {
+		return
+	}
+	graph := g.dependencyGraph()
+	return graph.keys(graph.precedentsClosure(ref)), nil
+}
+
+// TopologicalOrder Every formula cell of the workbook, each after the
+// formula cells it reads. Fails when formulas refer to each other in a circle
+func (g *Engine) TopologicalOrder() (cells []string, err error) {
+	graph := g.dependencyGraph()
+	order, err := graph.topologicalOrder()
+	if err != nil {
+		return
+	}
+	return graph.keys(order), nil
+}
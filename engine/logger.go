@@ -0,0 +1,30 @@
+package engine
+
+// Logger Leveled logger the engine reports diagnostics to. *logrus.Logger
+// and *logrus.Entry satisfy it
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Option Configures an Engine in NewEngine
+type Option func(*Engine)
+
+// WithLogger Send the engine's diagnostics to logger instead of discarding them
+func WithLogger(logger Logger) Option {
+	return func(g *Engine) {
+		if logger != nil {
+			g.logger = logger
+		}
+	}
+}
+
+// nopLogger Default Logger, silent
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
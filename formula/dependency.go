@@ -0,0 +1,104 @@
+package formula
+
+// Dependency Cells, a range or a defined name read by a formula. Name is
+// empty for cells. For names Reference only holds the sheet the name was
+// qualified with, e.g. Input for Input!Rate
+type Dependency struct {
+	Reference Reference
+	Name      string
+}
+
+// IsName Whether the dependency is a defined name rather than cells
+func (dependency Dependency) IsName() bool {
+	return dependency.Name != ""
+}
+
+// String Sheet qualified text of the dependency, e.g. Input!B2:B5 or Rate
+func (dependency Dependency) String() string {
+	if !dependency.IsName() {
+		return dependency.Reference.String()
+	} else if dependency.Reference.Sheet == "" {
+		return dependency.Name
+	}
+	return QuoteSheetName(dependency.Reference.Sheet) + "!" + dependency.Name
+}
+
+// Dependencies What the formula reads without evaluating it, see
+// NodeDependencies
+func (formula *Formula) Dependencies(sheet string) []Dependency {
+	return NodeDependencies(formula.GetEntryNode(), sheet)
+}
+
+// NodeDependencies Cells, ranges and names read under a node, each once in
+// order of appearance. References without a sheet are on sheet, the sheet
+// holding the formula. Ranges spanned by the : operator, e.g. A1:(B2), count
+// as one range. Cells picked at run time, e.g. by INDIRECT, are not known
+func NodeDependencies(node *Node, sheet string) []Dependency {
+	dependencies := []Dependency{}
+	seen := make(map[string]bool)
+	add := func(dependency Dependency) {
+		if key := dependency.String(); !seen[key] {
+			seen[key] = true
+			dependencies = append(dependencies, dependency)
+		}
+	}
+
+	Inspect(node, func(node *Node) bool {
+		switch node.nodeType {
+		case NodeTypeRef:
+			add(refDependency(node.value.(string), sheet))
+		case NodeTypeOperator:
+			if node.value != ":" {
+				break
+			} else if ref, ok := spannedRange(node, sheet); ok {
+				add(Dependency{Reference: ref})
+				return false
+			}
+		}
+		return true
+	})
+	return dependencies
+}
+
+// refDependency Dependency of the text of a Ref node, a name when the text
+// is no address
+func refDependency(text string, sheet string) Dependency {
+	if ref, err := ParseReference(text); err == nil {
+		if ref.Sheet == "" {
+			ref.Sheet = sheet
+		}
+		return Dependency{Reference: ref}
+	}
+
+	dependency := Dependency{Name: text}
+	if sheet, name, err := splitSheet(text); err == nil && sheet != "" {
+		dependency.Reference.Sheet = sheet
+		dependency.Name = name
+	}
+	return dependency
+}
+
+// spannedRange Range covered by a : operator whose operands are all
+// addresses on the same sheet
+func spannedRange(node *Node, sheet string) (span Reference, ok bool) {
+	for i, child := range node.children {
+		operand := child.unwrap()
+		if operand.nodeType != NodeTypeRef {
+			return
+		}
+		dependency := refDependency(operand.value.(string), sheet)
+		if dependency.IsName() {
+			return
+		}
+
+		ref := dependency.Reference
+		if i == 0 {
+			span = ref
+		} else if ref.Sheet != span.Sheet || ref.LastSheet != span.LastSheet {
+			return
+		} else {
+			span = span.Span(ref)
+		}
+	}
+	return span, true
+}
@@ -0,0 +1,49 @@
+package formula
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDependencies(t *testing.T) {
+	expectations := map[string]string{
+		`=1+2`:                                ``,
+		`=B2*B6-B7`:                           `Host!B2 Host!B6 Host!B7`,
+		`=SUM($B$9:B10)+B9*B9`:                `Host!B9:B10 Host!B9`,
+		`=Discounts!E2&'Rate Table'!A1`:       `Discounts!E2 'Rate Table'!A1`,
+		`=SUM(Jan:Dec!B5)`:                    `Jan:Dec!B5`,
+		`=SUM(B:B) + SUM(2:3)`:                `Host!B:B Host!2:3`,
+		`=Rate*Input!Rate + Rate`:             `Rate Input!Rate`,
+		`=SUM(A1:(B2))`:                       `Host!A1:B2`,
+		`=SUM(Input!B2:Input!D2)`:             `Input!B2:D2`,
+		`=SUM(Input!B2:(Input!D2))`:           `Input!B2:D2`,
+		`='A!B'!C1`:                           `'A!B'!C1`,
+		`=SUM(Age:B5)`:                        `Age Host!B5`,
+		`=SUM(A1:INDEX(B1:B5, 2))`:            `Host!A1 Host!B1:B5`,
+		`=SUM(B1:D5 C3:C9, (A1,Other!A2))`:    `Host!B1:D5 Host!C3:C9 Host!A1 Other!A2`,
+		`=IF(A1>0, {1,2}, INDIRECT("B" & 2))`: `Host!A1`,
+	}
+	for formulaText, expected := range expectations {
+		dependencies := NewFormula(formulaText).Dependencies("Host")
+		texts := make([]string, len(dependencies))
+		for i, dependency := range dependencies {
+			texts[i] = dependency.String()
+		}
+		if result := strings.Join(texts, " "); result != expected {
+			t.Errorf("%s Expected: %s\tActual: %s", formulaText, expected, result)
+		}
+	}
+}
+
+func TestDependencyNames(t *testing.T) {
+	dependencies := NewFormula(`='Rate Table'!Rate + A1`).Dependencies("Host")
+	if len(dependencies) != 2 {
+		t.Fatalf("Expected: 2 dependencies\tActual: %v", dependencies)
+	}
+	if result := dependencies[0]; !result.IsName() || result.Name != "Rate" || result.Reference.Sheet != "Rate Table" {
+		t.Errorf("Expected: Rate on Rate Table\tActual: %v", result)
+	}
+	if result := dependencies[1]; result.IsName() || result.Reference.From != (CellRef{Col: 0, Row: 0}) {
+		t.Errorf("Expected: A1\tActual: %v", result)
+	}
+}
@@ -0,0 +1,187 @@
+package formula
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ATOM_PRECEDENCE Operands, function calls and postfix operations never need
+// parentheses around them
+var ATOM_PRECEDENCE = 10
+
+// String Formula text in canonical Excel syntax, e.g. =SUM(A1:B2)*2
+func (formula *Formula) String() string {
+	return formula.Format()
+}
+
+// Format Formula text in canonical Excel syntax with minimal parentheses.
+// Empty when the formula could not be parsed
+func (formula *Formula) Format() string {
+	entry := formula.GetEntryNode()
+	if entry == nil {
+		return ""
+	}
+	return "=" + entry.Format()
+}
+
+// String Text of the expression under a node, see Format
+func (node *Node) String() string {
+	return node.Format()
+}
+
+// Format Text of the expression under a node without the leading =.
+// Parentheses are written where precedence needs them, not where the
+// original text had them
+func (node *Node) Format() string {
+	switch node.nodeType {
+	case NodeTypeOperator:
+		return node.formatOperator()
+	case NodeTypePrefix:
+		return fmt.Sprintf("%v", node.value) + node.FirstChild().formatOperand(PREFIX_PRECEDENCE)
+	case NodeTypePostfix:
+		return node.FirstChild().formatOperand(ATOM_PRECEDENCE) + fmt.Sprintf("%v", node.value)
+	case NodeTypeFunc:
+		return node.formatFunc()
+	case NodeTypeArray:
+		rows := make([]string, len(node.children))
+		for i, row := range node.children {
+			rows[i] = formatList(row.children, ",")
+		}
+		return "{" + strings.Join(rows, ";") + "}"
+	case NodeTypeRef:
+		return formatRef(node.value.(string))
+	case NodeTypeFloat:
+		return formatNumber(node.value.(float64))
+	case NodeTypeBoolean:
+		if node.value.(bool) {
+			return "TRUE"
+		}
+		return "FALSE"
+	case NodeTypeLiteral:
+		if text, ok := node.value.(string); ok {
+			return `"` + strings.Replace(text, `"`, `""`, -1) + `"`
+		}
+	case NodeTypeMissing:
+		// Omitted arguments leave nothing between their commas
+		return ""
+	}
+	return fmt.Sprintf("%v", node.value)
+}
+
+// formatOperator Operands joined by an infix operator. Left operands keep
+// operators of the same precedence bare, later ones need parentheses since
+// operators associate to the left
+func (node *Node) formatOperator() string {
+	operator := node.value.(string)
+	precedence := PRECEDENCE[operator]
+
+	operands := make([]string, len(node.children))
+	for i, child := range node.children {
+		if i < len(node.children)-1 && precedence > PREFIX_PRECEDENCE && child.endsInPrefix() {
+			// A prefix at the end of an operand would swallow the tighter
+			// operator which follows, 2^(-1)^2 and (2^-1)^2
+			operands[i] = "(" + child.Format() + ")"
+		} else if i == 0 {
+			operands[i] = child.formatOperand(precedence)
+		} else if child.unwrap().nodeType == NodeTypePrefix {
+			// A prefix starts a new operand, 2^-1
+			operands[i] = child.Format()
+		} else {
+			operands[i] = child.formatOperand(precedence + 1)
+		}
+	}
+
+	text := strings.Join(operands, operator)
+	if operator == "," {
+		// Unions are always parenthesized, otherwise , separates arguments
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// formatOperand Text of an operand, parenthesized when it binds looser than
+// minPrecedence. Unions bring their own parentheses
+func (node *Node) formatOperand(minPrecedence int) string {
+	text := node.Format()
+	if operand := node.unwrap(); operand.precedence() < minPrecedence && !(operand.nodeType == NodeTypeOperator && operand.value == ",") {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// endsInPrefix Whether the text of a node ends in a prefix operation left
+// bare, as 2^-1 does
+func (node *Node) endsInPrefix() bool {
+	node = node.unwrap()
+	if node.nodeType == NodeTypePrefix {
+		return true
+	} else if node.nodeType != NodeTypeOperator || node.value == "," {
+		return false
+	}
+
+	// The last operand is bare when it is a prefix or binds tighter
+	last := node.children[len(node.children)-1].unwrap()
+	return (last.nodeType == NodeTypePrefix || last.precedence() > node.precedence()) && last.endsInPrefix()
+}
+
+// formatFunc Function call, or the expression of a parenthesized one
+func (node *Node) formatFunc() string {
+	if node.value == "IDENTITY" {
+		return node.FirstChild().Format()
+	}
+	return fmt.Sprintf("%v(%s)", node.value, formatList(node.children, ","))
+}
+
+// unwrap Expression inside any number of redundant parentheses
+func (node *Node) unwrap() *Node {
+	for node.nodeType == NodeTypeFunc && node.value == "IDENTITY" && node.HasChildren() {
+		node = node.FirstChild()
+	}
+	return node
+}
+
+// precedence Binding strength of the operation at a node
+func (node *Node) precedence() int {
+	switch node.nodeType {
+	case NodeTypeOperator:
+		return PRECEDENCE[node.value.(string)]
+	case NodeTypePrefix:
+		return PREFIX_PRECEDENCE
+	default:
+		return ATOM_PRECEDENCE
+	}
+}
+
+func formatList(nodes []*Node, separator string) string {
+	items := make([]string, len(nodes))
+	for i, node := range nodes {
+		items[i] = node.Format()
+	}
+	return strings.Join(items, separator)
+}
+
+// formatRef Reference with its sheet quoted again, the tokenizer hands them
+// over unquoted unless the name holds a !
+func formatRef(text string) string {
+	sheet, address, err := splitSheet(text)
+	if err != nil || sheet == "" {
+		return text
+	}
+
+	sheets := strings.SplitN(sheet, ":", 2)
+	if len(sheets) == 1 {
+		return QuoteSheetName(sheet) + "!" + address
+	}
+	return quoteSheets(sheets[0], sheets[1]) + "!" + address
+}
+
+// formatNumber Shortest text of a number, in scientific notation when very
+// large or small
+func formatNumber(number float64) string {
+	if magnitude := math.Abs(number); magnitude >= 1e15 || (magnitude < 1e-9 && magnitude > 0) {
+		return strconv.FormatFloat(number, 'E', -1, 64)
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
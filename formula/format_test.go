@@ -0,0 +1,131 @@
+package formula
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	expectations := map[string]string{
+		`=1+2*3`:                    `=1+2*3`,
+		`=(1+2)*3`:                  `=(1+2)*3`,
+		`=((1+2))*3`:                `=(1+2)*3`,
+		`=1+(2*3)`:                  `=1+2*3`,
+		`=1-(2-3)`:                  `=1-(2-3)`,
+		`=(1-2)-3`:                  `=1-2-3`,
+		`=2^(3^2)`:                  `=2^(3^2)`,
+		`=-2^2`:                     `=-2^2`,
+		`=(-2)^2`:                   `=(-2)^2`,
+		`=2^(-1)^2`:                 `=2^(-1)^2`,
+		`=(2^-1)^2`:                 `=(2^-1)^2`,
+		`=(2^--1)^2^3`:              `=(2^--1)^2^3`,
+		`=(2^-1)^-2`:                `=(2^-1)^-2`,
+		`=(2^-1)*3`:                 `=2^-1*3`,
+		`=(1*2^-1)^2`:               `=(1*2^-1)^2`,
+		`=2^(3*-1)`:                 `=2^(3*-1)`,
+		`=2*-1*3`:                   `=2*-1*3`,
+		`=2^-1`:                     `=2^-1`,
+		`=--A1`:                     `=--A1`,
+		`=-(1+2)`:                   `=-(1+2)`,
+		`=B4*15%`:                   `=B4*15%`,
+		`=(1+2)%`:                   `=(1+2)%`,
+		`=1=2=3`:                    `=1=2=3`,
+		`=1=(2=3)`:                  `=1=(2=3)`,
+		`="Plan "&(B16+1)&"!"`:      `="Plan "&B16+1&"!"`,
+		`="say ""hi"""&A1`:          `="say ""hi"""&A1`,
+		`=IF(A1 >= 10, TRUE, "no")`: `=IF(A1>=10,TRUE,"no")`,
+		`=IF(A1,,2)`:                `=IF(A1,,2)`,
+		`=IF(A1,"",2)`:              `=IF(A1,"",2)`,
+		`=IF(A1, , )`:               `=IF(A1,,)`,
+		`=VLOOKUP(1,A:B,2,)`:        `=VLOOKUP(1,A:B,2,)`,
+		`=$A$1+Input!B$2`:           `=$A$1+Input!B$2`,
+		`=SUM('Rate Table'!A1:B2)`:  `=SUM('Rate Table'!A1:B2)`,
+		`='Bob''s'!A1`:              `='Bob''s'!A1`,
+		`=SUM(Jan:Dec!B5)`:          `=SUM(Jan:Dec!B5)`,
+		`=SUM('Jan 1:Dec'!B5)`:      `=SUM('Jan 1:Dec'!B5)`,
+		`={1,-2;"a",TRUE}`:          `={1,-2;"a",TRUE}`,
+		`=SUM((A1:A5,C1:C5))`:       `=SUM((A1:A5,C1:C5))`,
+		`=B1:D5 C3:C9`:              `=B1:D5 C3:C9`,
+		`=SUM((A1,B2) C3)`:          `=SUM((A1,B2) C3)`,
+		`=SUM(A1:(B2))`:             `=SUM(A1:B2)`,
+		`=SUM(Input!B2:Input!D2)`:   `=SUM(Input!B2:Input!D2)`,
+		`=Input!B2:(Input!D2)`:      `=Input!B2:Input!D2`,
+		`='A!B'!C1+1`:               `='A!B'!C1+1`,
+		`=IFERROR(1/0, #DIV/0!)`:    `=IFERROR(1/0,#DIV/0!)`,
+		`=#N/A`:                     `=#N/A`,
+		`=1E+20+0.5`:                `=1E+20+0.5`,
+		`=VLOOKUP(3, Rates!A:D, 2)`: `=VLOOKUP(3,Rates!A:D,2)`,
+	}
+	for text, expected := range expectations {
+		formula, err := Parse(text)
+		if err != nil {
+			t.Errorf("%s Expected: %s\tActual: %v", text, expected, err)
+			continue
+		}
+		if result := formula.String(); result != expected {
+			t.Errorf("%s Expected: %s\tActual: %s", text, expected, result)
+		}
+
+		// Canonical text parses back into the same tree and text
+		if reparsed, err := Parse(expected); err != nil || reparsed.Format() != expected {
+			t.Errorf("%s Expected: %s\tActual: %v %v", expected, expected, reparsed, err)
+		} else if !sameTree(formula.GetEntryNode(), reparsed.GetEntryNode()) {
+			t.Errorf("%s Expected: tree of %s\tActual: tree of %s", expected, text, expected)
+		}
+	}
+}
+
+// sameTree Whether two trees compute the same, redundant parentheses, ranges
+// spanned by : and left nested operators such as (1-2)-3 aside
+func sameTree(node *Node, other *Node) bool {
+	node, other = node.unwrap(), other.unwrap()
+	if area, ok := areaOf(node); ok {
+		otherArea, ok := areaOf(other)
+		return ok && area == otherArea
+	}
+
+	children, otherChildren := operands(node), operands(other)
+	if node.nodeType != other.nodeType || node.value != other.value || len(children) != len(otherChildren) {
+		return false
+	}
+	for i := range children {
+		if !sameTree(children[i], otherChildren[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// areaOf Range of an address or of a : operator between addresses
+func areaOf(node *Node) (area Reference, ok bool) {
+	if node.nodeType == NodeTypeRef {
+		dependency := refDependency(node.value.(string), "")
+		return dependency.Reference, !dependency.IsName()
+	} else if node.nodeType == NodeTypeOperator && node.value == ":" {
+		return spannedRange(node, "")
+	}
+	return
+}
+
+// operands Children of a node, with those of a left operand under the same
+// operator taken in
+func operands(node *Node) []*Node {
+	if node.nodeType != NodeTypeOperator || len(node.children) == 0 {
+		return node.children
+	} else if first := node.children[0].unwrap(); first.nodeType == NodeTypeOperator && first.value == node.value {
+		return append(append([]*Node{}, operands(first)...), node.children[1:]...)
+	}
+	return node.children
+}
+
+func TestFormatNode(t *testing.T) {
+	formula := NewFormula(`=SUM(A1, 2*(3+4))`)
+	if result := formula.GetEntryNode().ChildAt(1).String(); result != "2*(3+4)" {
+		t.Errorf("Expected: 2*(3+4)\tActual: %s", result)
+	}
+	if result := formula.GetEntryNode().ChildAt(1).ChildAt(1).String(); result != "3+4" {
+		t.Errorf("Expected: 3+4\tActual: %s", result)
+	}
+
+	formula = NewFormula(`=SUM(1,`)
+	if result := formula.String(); result != "" {
+		t.Errorf("Expected: empty\tActual: %s", result)
+	}
+}
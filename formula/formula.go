@@ -3,6 +3,7 @@ package formula
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/xuri/efp"
 )
@@ -25,205 +26,555 @@ const (
 	NodeTypeFunc
 	// NodeTypeOperator Infix operator
 	NodeTypeOperator
+	// NodeTypePrefix Prefix operator, e.g. unary minus
+	NodeTypePrefix
+	// NodeTypePostfix Postfix operator, e.g. percent
+	NodeTypePostfix
+	// NodeTypeError Error literal, e.g. #DIV/0!
+	NodeTypeError
+	// NodeTypeArray Array constant, children are its rows
+	NodeTypeArray
+	// NodeTypeArrayRow Row of an array constant, children are literals
+	NodeTypeArrayRow
+	// NodeTypeBoolean Literal TRUE or FALSE, value is a bool
+	NodeTypeBoolean
+	// NodeTypeMissing Omitted argument, e.g. the second one of IF(A1,,2),
+	// value is empty
+	NodeTypeMissing
 )
 
+// PRECEDENCE Binding strength of infix operators, comparisons bind loosest and
+// the reference operators : (range), " " (intersection) and , (union) tightest
 var PRECEDENCE = map[string]int{
-	"+": 1,
-	"-": 1,
-	"*": 2,
-	"/": 2,
+	"=":  1,
+	"<>": 1,
+	"<":  1,
+	">":  1,
+	"<=": 1,
+	">=": 1,
+	"&":  2,
+	"+":  3,
+	"-":  3,
+	"*":  4,
+	"/":  4,
+	"^":  6,
+	",":  7,
+	" ":  8,
+	":":  9,
 }
 
+// PREFIX_PRECEDENCE Unary operators bind tighter than infix * and / but looser than ^
+var PREFIX_PRECEDENCE = 5
+
 // Node AST node
 type Node struct {
-	value      interface{}
-	nodeType   NodeType
-	children   []*Node
-	parent     *Node
-	infixChild *Node
+	value    interface{}
+	nodeType NodeType
+	children []*Node
+	parent   *Node
+	span     Span
 }
 
 // Formula Formula1 executable formula
 type Formula struct {
-	root Node
+	root *Node
+}
+
+// ParseError Describes where and why a formula text could not be parsed
+type ParseError struct {
+	// Position Index of the offending token, equals the token count at end of formula
+	Position int
+	// Token Text of the offending token, empty at end of formula
+	Token string
+	// Expected Construct the parser was looking for
+	Expected string
+	// Span Location of the offending token in the formula text, empty at
+	// the end of the text when the formula ends early
+	Span Span
+}
+
+func (err *ParseError) Error() string {
+	if err.Token == "" {
+		return fmt.Sprintf("Unexpected end of formula at token %d, expected %s",
+			err.Position, err.Expected)
+	}
+	return fmt.Sprintf("Unexpected '%s' at token %d, expected %s",
+		err.Token, err.Position, err.Expected)
 }
 
-// NewFormula Create a new formula instance
+// parser Recursive descent over the efp token stream
+type parser struct {
+	tokens []efp.Token
+	// spans Location of each token in text
+	spans []Span
+	text  string
+	index int
+}
+
+// NewFormula Create a new formula instance. Malformed text yields a formula
+// without entry node, use Parse to find out why.
 func NewFormula(text string) *Formula {
-	parser := efp.ExcelParser()
-	parser.Parse(text)
-	fmt.Printf("%s\n=====\n", parser.PrettyPrint())
+	formula, _ := Parse(text)
+	return formula
+}
 
-	tokens := parser.Tokens.Items
-	root := Node{
+// Parse Create a new formula instance, reporting malformed text as *ParseError
+func Parse(text string) (*Formula, error) {
+	efpParser := efp.ExcelParser()
+	efpParser.Parse(text)
+
+	root := &Node{
 		value:    "root",
 		nodeType: NodeTypeRoot,
 		children: nil,
+		span:     Span{Start: 0, End: len(text)},
+	}
+	formula := Formula{
+		root: root,
 	}
 
-	current := &root
-	index := 0
-	count := len(tokens)
+	p := parser{
+		tokens: efpParser.Tokens.Items,
+		spans:  tokenSpans(text, efpParser.Tokens.Items),
+		text:   text,
+	}
+	entry, err := p.parseExpression(0)
+	if err != nil {
+		return &formula, err
+	}
+	if token := p.peek(); token != nil {
+		return &formula, p.unexpected("operator or end of formula")
+	}
 
-	var token *efp.Token
+	root.appendChild(entry)
+	return &formula, nil
+}
 
-	for index <= count {
-		if index >= count {
-			if current.infixChild != nil {
-				if current.children == nil {
-					current.children = []*Node{current.infixChild}
-				} else {
-					current.children = append(current.children, current.infixChild)
-				}
-				current.resetInfixChild()
-			}
+// GetEntryNode First node to be evaluated, nil if the formula could not be parsed
+func (formula *Formula) GetEntryNode() *Node {
+	return formula.root.FirstChild()
+}
 
-			if root.infixChild != nil {
-				if root.children == nil {
-					root.children = []*Node{root.infixChild}
-				} else {
-					root.children = append(root.children, root.infixChild)
-					root.resetInfixChild()
-				}
-			}
-			break
+// peek Current token without consuming it, nil at end of formula
+func (p *parser) peek() *efp.Token {
+	if p.index >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.index]
+}
+
+func (p *parser) next() *efp.Token {
+	token := p.peek()
+	if token != nil {
+		p.index++
+	}
+	return token
+}
+
+// spanAt Location of the token at index, an empty span at the end of the
+// text past the last token
+func (p *parser) spanAt(index int) Span {
+	if index >= len(p.spans) {
+		return Span{Start: len(p.text), End: len(p.text)}
+	}
+	return p.spans[index]
+}
+
+// spanFrom Location of the tokens from index up to the last one consumed
+func (p *parser) spanFrom(index int) Span {
+	return Span{Start: p.spanAt(index).Start, End: p.spanAt(p.index - 1).End}
+}
+
+// unexpected Describe the current token as a parse error
+func (p *parser) unexpected(expected string) error {
+	err := &ParseError{
+		Position: p.index,
+		Expected: expected,
+		Span:     p.spanAt(p.index),
+	}
+	if token := p.peek(); token != nil {
+		err.Token = describeToken(token)
+	}
+	return err
+}
+
+// parseExpression Parse infix operations whose precedence is at least minPrecedence
+func (p *parser) parseExpression(minPrecedence int) (node *Node, err error) {
+	if node, err = p.parseUnary(); err != nil {
+		return
+	}
+
+	for {
+		token := p.peek()
+		if token == nil || token.TType != efp.TokenTypeOperatorInfix {
+			return
 		}
 
-		token = &tokens[index]
-		tvalue := token.TValue
-		ttype := token.TType
-		tsubtype := token.TSubType
-		var value interface{}
-		var nodeType NodeType
-
-		if tsubtype == efp.TokenSubTypeStart {
-			value, nodeType = resolveNodeType(ttype, tsubtype, tvalue)
-			if current.infixChild != nil {
-				parent := current
-				current = current.infixChild.makeNode(nodeType, value)
-				current.parent = parent
-			} else {
-				current = current.makeNode(nodeType, value)
-			}
+		operator := token.TValue
+		if token.TSubType == efp.TokenSubTypeIntersection {
+			operator = " "
+		}
+		precedence, ok := PRECEDENCE[operator]
+		if !ok {
+			err = p.unexpected("operator")
+			return
+		}
+		if precedence < minPrecedence {
+			return
+		}
+		p.next()
 
-			index++
-			continue
-		} else if tsubtype == efp.TokenSubTypeStop {
-			if current.infixChild != nil {
-				current.children = append(current.children, current.infixChild)
-				current.resetInfixChild()
-			}
+		var operand *Node
+		if operand, err = p.parseExpression(precedence + 1); err != nil {
+			return
+		}
 
-			current = current.parent
+		if node.nodeType == NodeTypeOperator && node.value == operator && isVariadic(operator) {
+			// Left associative chains of the same operator share one node: ((10 20 30)+ 1 2)-
+			node.appendChild(operand)
+		} else {
+			operation := newNode(NodeTypeOperator, operator)
+			operation.appendChild(node)
+			operation.appendChild(operand)
+			operation.span.Start = node.span.Start
+			node = operation
+		}
+		node.span.End = operand.span.End
+	}
+}
 
-			index++
-			continue
-		} else if ttype == efp.TokenTypeArgument {
-			if current.infixChild != nil {
-				current.children = append(current.children, current.infixChild)
-				current.resetInfixChild()
-			}
-			index++
-			continue
-		} else if ttype == efp.TokenTypeOperatorInfix {
-			current.makeInfixChild(tvalue)
+// parseUnary Parse an operand preceded by any number of prefix operators
+func (p *parser) parseUnary() (node *Node, err error) {
+	token := p.peek()
+	if token == nil || token.TType != efp.TokenTypeOperatorPrefix {
+		return p.parsePostfix()
+	}
+	start := p.index
+	p.next()
+
+	var operand *Node
+	if operand, err = p.parseExpression(PREFIX_PRECEDENCE); err != nil {
+		return
+	}
 
-			index++
+	node = newNode(NodeTypePrefix, token.TValue)
+	node.appendChild(operand)
+	node.span = p.spanFrom(start)
+	return
+}
+
+// parsePostfix Parse an operand followed by any number of postfix operators
+func (p *parser) parsePostfix() (node *Node, err error) {
+	if node, err = p.parseOperand(); err != nil {
+		return
+	}
+
+	for token := p.peek(); token != nil && token.TType == efp.TokenTypeOperatorPostfix; token = p.peek() {
+		p.next()
+
+		operand := node
+		node = newNode(NodeTypePostfix, token.TValue)
+		node.appendChild(operand)
+		node.span = Span{Start: operand.span.Start, End: p.spanAt(p.index - 1).End}
+	}
+	return
+}
+
+// parseOperand Parse a literal, reference, function call or subexpression
+func (p *parser) parseOperand() (node *Node, err error) {
+	token := p.peek()
+	if token == nil {
+		err = p.unexpected("operand")
+		return
+	}
+
+	switch {
+	case token.TType == efp.TokenTypeOperand:
+		p.next()
+		if node = tokenNode(token); node.nodeType == NodeTypeRef {
+			node = p.rangeNode(token.TValue, p.spanAt(p.index-1))
+		}
+		node.span = p.spanAt(p.index - 1)
+	case token.TType == efp.TokenTypeFunction && token.TSubType == efp.TokenSubTypeStart && strings.Contains(token.TValue, ":"):
+		node, err = p.parseRangeFunction()
+	case token.TType == efp.TokenTypeFunction && token.TSubType == efp.TokenSubTypeStart && token.TValue == "ARRAY":
+		node, err = p.parseArray()
+	case token.TType == efp.TokenTypeFunction && token.TSubType == efp.TokenSubTypeStart:
+		node, err = p.parseFunction()
+	case token.TType == efp.TokenTypeSubexpression && token.TSubType == efp.TokenSubTypeStart:
+		node, err = p.parseSubexpression()
+	default:
+		err = p.unexpected("operand")
+	}
+	return
+}
+
+// parseRangeFunction Parse a reference joined by : to a function or to a
+// parenthesised expression, which the tokenizer reads as one function start,
+// e.g. A1:INDEX( or A1:(
+func (p *parser) parseRangeFunction() (node *Node, err error) {
+	token := p.peek()
+	index := strings.LastIndex(token.TValue, ":")
+	if index == 0 {
+		err = p.unexpected("reference")
+		return
+	}
+	start := newNode(NodeTypeRef, token.TValue[:index])
+
+	// Leave only the function behind the colon for parseOperand, splitting
+	// the token's span the same way
+	span := p.spanAt(p.index)
+	if colon := strings.LastIndex(p.text[span.Start:span.End], ":"); colon >= 0 {
+		start.span = Span{Start: span.Start, End: span.Start + colon}
+		p.spans[p.index].Start = span.Start + colon + 1
+	}
+	token.TValue = token.TValue[index+1:]
+	if token.TValue == "" {
+		token.TType = efp.TokenTypeSubexpression
+	}
+
+	var end *Node
+	if end, err = p.parseOperand(); err != nil {
+		return
+	}
+	node = newNode(NodeTypeOperator, ":")
+	node.appendChild(start)
+	node.appendChild(end)
+	node.span = Span{Start: span.Start, End: end.span.End}
+	return
+}
+
+// parseFunction Parse a function call and its comma separated arguments
+func (p *parser) parseFunction() (node *Node, err error) {
+	start := p.index
+	token := p.next()
+	node = tokenNode(token)
+	defer func() { node.span = p.spanFrom(start) }()
+
+	if p.isStop() {
+		p.next()
+		return
+	}
+
+	for {
+		var argument *Node
+		if token := p.peek(); token != nil && (token.TType == efp.TokenTypeArgument || p.isStop()) {
+			// Omitted argument, e.g. IF(A1,,2)
+			argument = newNode(NodeTypeMissing, "")
+			argument.span = Span{Start: p.spanAt(p.index).Start, End: p.spanAt(p.index).Start}
+		} else if argument, err = p.parseExpression(0); err != nil {
+			return
+		}
+		node.appendChild(argument)
+
+		token := p.peek()
+		if token != nil && token.TType == efp.TokenTypeArgument {
+			p.next()
 			continue
-		} else if ttype == efp.TokenTypeOperand {
-			value, nodeType = resolveNodeType(ttype, tsubtype, tvalue)
-			if current.infixChild != nil {
-				current.infixChild.makeNode(nodeType, value)
-			} else {
-				current.makeNode(nodeType, value)
+		} else if p.isStop() {
+			p.next()
+			return
+		}
+
+		err = p.unexpected("',' or ')'")
+		return
+	}
+}
+
+// parseArray Parse an array constant, e.g. {1,2;3,4}. efp reports it as an ARRAY
+// function whose arguments are ARRAYROW functions.
+func (p *parser) parseArray() (node *Node, err error) {
+	start := p.index
+	token := p.next()
+	node = newNode(NodeTypeArray, token.TValue)
+	defer func() { node.span = p.spanFrom(start) }()
+
+	for {
+		token = p.peek()
+		if token == nil || token.TType != efp.TokenTypeFunction || token.TValue != "ARRAYROW" {
+			err = p.unexpected("array row")
+			return
+		}
+		rowStart := p.index
+		p.next()
+
+		row := newNode(NodeTypeArrayRow, token.TValue)
+		for {
+			var element *Node
+			if element, err = p.parseArrayElement(); err != nil {
+				return
 			}
+			row.appendChild(element)
+
+			if token := p.peek(); token != nil && token.TType == efp.TokenTypeArgument {
+				p.next()
+				continue
+			} else if !p.isStop() {
+				err = p.unexpected("',', ';' or '}'")
+				return
+			}
+			break
+		}
 
-			index++
-			continue
-		} else {
-			index++
+		if node.HasChildren() && row.ChildCount() != node.FirstChild().ChildCount() {
+			err = p.unexpected("array rows of equal length")
+			return
+		}
+		p.next()
+		row.span = p.spanFrom(rowStart)
+		node.appendChild(row)
 
+		if token := p.peek(); token != nil && token.TType == efp.TokenTypeArgument {
+			p.next()
 			continue
+		} else if p.isStop() {
+			p.next()
+			return
 		}
+
+		err = p.unexpected("';' or '}'")
+		return
 	}
+}
 
-	formula := Formula{
-		root: root,
+// parseArrayElement Parse a constant within an array, optionally negated
+func (p *parser) parseArrayElement() (node *Node, err error) {
+	start := p.index
+	token := p.peek()
+	negative := token != nil && token.TType == efp.TokenTypeOperatorPrefix && token.TValue == "-"
+	if negative {
+		p.next()
+		token = p.peek()
+	}
+
+	if token == nil || token.TType != efp.TokenTypeOperand || token.TSubType == efp.TokenSubTypeRange {
+		err = p.unexpected("array constant")
+		return
+	} else if negative && token.TSubType != efp.TokenSubTypeNumber {
+		err = p.unexpected("number")
+		return
+	}
+	p.next()
+
+	node = tokenNode(token)
+	node.span = p.spanFrom(start)
+	if negative {
+		node.value = -node.value.(float64)
 	}
-	return &formula
+	return
 }
 
-func (formula *Formula) GetEntryNode() *Node {
-	return formula.root.children[0]
+// parseSubexpression Parse a parenthesized expression into an IDENTITY call
+func (p *parser) parseSubexpression() (node *Node, err error) {
+	start := p.index
+	token := p.next()
+	node = tokenNode(token)
+	defer func() { node.span = p.spanFrom(start) }()
+
+	var operand *Node
+	if operand, err = p.parseExpression(0); err != nil {
+		return
+	}
+	node.appendChild(operand)
+
+	if !p.isStop() {
+		err = p.unexpected("')'")
+		return
+	}
+	p.next()
+	return
+}
+
+// isStop Checks if current token closes a function or subexpression
+func (p *parser) isStop() bool {
+	token := p.peek()
+	return token != nil && token.TSubType == efp.TokenSubTypeStop
 }
 
-func (parent *Node) makeNode(nodeType NodeType, value interface{}) *Node {
-	node := Node{
+// isVariadic Checks if consecutive operations may be folded into one operator node
+func isVariadic(operator string) bool {
+	switch operator {
+	case "+", "-", "*", "/", "^", "&", ":", " ", ",":
+		return true
+	default:
+		return false
+	}
+}
+
+func describeToken(token *efp.Token) string {
+	switch {
+	case token.TSubType == efp.TokenSubTypeStop:
+		return ")"
+	case token.TType == efp.TokenTypeSubexpression:
+		return "("
+	case token.TType == efp.TokenTypeFunction:
+		return token.TValue + "("
+	case token.TSubType == efp.TokenSubTypeText:
+		return `"` + token.TValue + `"`
+	default:
+		return token.TValue
+	}
+}
+
+func newNode(nodeType NodeType, value interface{}) *Node {
+	return &Node{
 		value:    value,
 		nodeType: nodeType,
-		parent:   parent,
 		children: nil,
 	}
-	if parent.children == nil {
-		parent.children = []*Node{&node}
-	} else {
-		parent.children = append(parent.children, &node)
-	}
-
-	return &node
 }
 
-func (parent *Node) makeInfixChild(value string) *Node {
-	if parent.infixChild == nil {
-		parent.infixChild = &Node{
-			value:    value,
-			nodeType: NodeTypeOperator,
-			parent:   parent,
-			children: []*Node{},
-		}
-		if len(parent.children) > 0 {
-			lastChild := parent.LastChild()
-			parent.children = parent.children[0 : parent.ChildCount()-1]
-			parent.infixChild.children = []*Node{lastChild}
-		}
-	} else if parent.infixChild.value != value {
-		// Infix precedence resolution
-		if PRECEDENCE[value] > PRECEDENCE[parent.infixChild.value.(string)] {
-			// Detach the last child and append it to the new node's children
-			temp := parent.infixChild
-			node := &Node{
-				value:    value,
-				nodeType: NodeTypeOperator,
-				parent:   parent,
-				children: []*Node{
-					temp,
-					temp.children[temp.ChildCount()-1],
-				},
-			}
-			temp.children[temp.ChildCount()-1].parent = node
-			temp.children = temp.children[:temp.ChildCount()-2]
+// rangeNode Reference operand, or a : range between references the tokenizer
+// read as one operand because one side is a name, e.g. Age:B5
+func (p *parser) rangeNode(text string, span Span) *Node {
+	source := p.text[span.Start:span.End]
+	if _, err := ParseReference(text); err == nil {
+		return newNode(NodeTypeRef, text)
+	} else if _, err := ParseReference(source); err == nil && strings.HasPrefix(source, "'") {
+		// The token lost the quotes telling 'Bob!s'!A1 from Bob!s!A1
+		return newNode(NodeTypeRef, source)
+	}
 
-			parent.infixChild = node
-		} else {
-			// Simply wrap the existing infixChild inside the new one
-			temp := parent.infixChild
-			node := &Node{
-				value:    value,
-				nodeType: NodeTypeOperator,
-				parent:   parent,
-				children: []*Node{
-					temp,
-				},
-			}
-			parent.infixChild = node
-		}
+	sheet, address := "", text
+	if index := strings.Index(text, "!"); index >= 0 {
+		sheet, address = text[:index+1], text[index+1:]
+	}
+	index := strings.Index(address, ":")
+	if index <= 0 || index == len(address)-1 || strings.Contains(sheet, ":") {
+		return newNode(NodeTypeRef, text)
 	}
 
-	return parent.infixChild
+	// Both ends live on the sheet written in front, Sheet1!Age:B5, unless the
+	// second names its own, Input!B2:Input!D2
+	end := address[index+1:]
+	if !strings.Contains(end, "!") {
+		end = sheet + end
+	}
+	node := newNode(NodeTypeOperator, ":")
+	node.appendChild(newNode(NodeTypeRef, sheet+address[:index]))
+	node.appendChild(newNode(NodeTypeRef, end))
+
+	bang := strings.Index(source, "!") + 1
+	if colon := strings.Index(source[bang:], ":"); colon >= 0 {
+		node.FirstChild().span = Span{Start: span.Start, End: span.Start + bang + colon}
+		node.LastChild().span = Span{Start: span.Start + bang + colon + 1, End: span.End}
+	}
+	return node
 }
 
-func (parent *Node) resetInfixChild() {
-	parent.infixChild = nil
+// tokenNode Create a detached node from an operand, function or subexpression token
+func tokenNode(token *efp.Token) *Node {
+	value, nodeType := resolveNodeType(token.TType, token.TSubType, token.TValue)
+	return newNode(nodeType, value)
+}
+
+func (parent *Node) appendChild(node *Node) {
+	node.parent = parent
+	if parent.children == nil {
+		parent.children = []*Node{node}
+	} else {
+		parent.children = append(parent.children, node)
+	}
 }
 
 func resolveNodeType(ttype string, tsubtype string, tvalue string) (value interface{}, nodeType NodeType) {
@@ -244,6 +595,14 @@ func resolveNodeType(ttype string, tsubtype string, tvalue string) (value interf
 		nodeType = NodeTypeLiteral
 		value = tvalue
 		return
+	} else if ttype == efp.TokenTypeOperand && tsubtype == efp.TokenSubTypeLogical {
+		nodeType = NodeTypeBoolean
+		value = tvalue == "TRUE"
+		return
+	} else if ttype == efp.TokenTypeOperand && tsubtype == efp.TokenSubTypeError {
+		nodeType = NodeTypeError
+		value = tvalue
+		return
 	} else if ttype == efp.TokenTypeOperand && tsubtype == efp.TokenSubTypeNumber {
 		nodeType = NodeTypeFloat
 		value, _err = strconv.ParseFloat(tvalue, 64)
@@ -315,3 +674,35 @@ func (parent *Node) Children() []*Node {
 	}
 	return parent.children[:]
 }
+
+// Span Where the node was written in the formula text, empty for nodes
+// which were not parsed from text
+func (node *Node) Span() Span {
+	return node.span
+}
+
+// Parent Node this node is a child of, nil for the entry node
+func (node *Node) Parent() *Node {
+	if node.parent == nil || node.parent.nodeType == NodeTypeRoot {
+		return nil
+	}
+	return node.parent
+}
+
+// Depth Number of nodes above this one, 0 for the entry node
+func (node *Node) Depth() int {
+	depth := 0
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		depth++
+	}
+	return depth
+}
+
+// PathToRoot This node followed by its parents up to the entry node
+func (node *Node) PathToRoot() []*Node {
+	path := []*Node{}
+	for current := node; current != nil; current = current.Parent() {
+		path = append(path, current)
+	}
+	return path
+}
@@ -246,11 +246,11 @@ func TestMultiParamFunctions(t *testing.T) {
 	if formula.root.FirstChild().ChildCount() != 2 {
 		t.Errorf("Formula root has two children")
 	}
-	if formula.root.FirstChild().FirstChild().nodeType != NodeTypeLiteral {
-		t.Errorf("True branch is a range")
+	if formula.root.FirstChild().FirstChild().nodeType != NodeTypeBoolean {
+		t.Errorf("True branch is a boolean")
 	}
-	if formula.root.FirstChild().children[1].nodeType != NodeTypeLiteral {
-		t.Errorf("False branch is a literal")
+	if formula.root.FirstChild().children[1].nodeType != NodeTypeBoolean {
+		t.Errorf("False branch is a boolean")
 	}
 }
 
@@ -281,11 +281,11 @@ func TestNestedFunctions(t *testing.T) {
 	if condition.ChildCount() != 2 {
 		t.Errorf("Formula root has two children")
 	}
-	if condition.FirstChild().nodeType != NodeTypeLiteral {
-		t.Errorf("True branch is a range")
+	if condition.FirstChild().nodeType != NodeTypeBoolean {
+		t.Errorf("True branch is a boolean")
 	}
-	if condition.children[1].nodeType != NodeTypeLiteral {
-		t.Errorf("False branch is a literal")
+	if condition.children[1].nodeType != NodeTypeBoolean {
+		t.Errorf("False branch is a boolean")
 	}
 }
 
@@ -307,8 +307,8 @@ func TestNestedFunctionsWithInfixes(t *testing.T) {
 	if condition.FirstChild().nodeType != NodeTypeOperator {
 		t.Errorf("True branch is an operator. Actual: %d", condition.FirstChild().nodeType)
 	}
-	if condition.children[1].nodeType != NodeTypeLiteral {
-		t.Errorf("False branch is a literal. Actual: %d", condition.children[1].nodeType)
+	if condition.children[1].nodeType != NodeTypeBoolean {
+		t.Errorf("False branch is a boolean. Actual: %d", condition.children[1].nodeType)
 	}
 }
 
@@ -395,3 +395,300 @@ func TestPricerFormula(t *testing.T) {
 	}
 
 }
+
+func TestParseError(t *testing.T) {
+	var err error
+
+	if _, err = Parse(`=SUM(1,`); err == nil {
+		t.Errorf("Expected: ParseError\tActual: nil")
+	} else if result, ok := err.(*ParseError); !ok {
+		t.Errorf("Expected: *ParseError\tActual: %T", err)
+	} else if result.Token != "" || result.Position != 3 {
+		t.Errorf("Expected: end of formula at 3\tActual: '%s' at %d", result.Token, result.Position)
+	}
+
+	if _, err = Parse(`=1 +`); err == nil {
+		t.Errorf("Expected: ParseError\tActual: nil")
+	} else if result := err.(*ParseError); result.Expected != "operand" {
+		t.Errorf("Expected: operand\tActual: %s", result.Expected)
+	}
+
+	if _, err = Parse(`=(1 + 2`); err == nil {
+		t.Errorf("Expected: ParseError\tActual: nil")
+	} else if result := err.(*ParseError); result.Expected != "')'" {
+		t.Errorf("Expected: ')'\tActual: %s", result.Expected)
+	}
+
+	if _, err = Parse(`=1 + 2)`); err == nil {
+		t.Errorf("Expected: ParseError\tActual: nil")
+	} else if result := err.(*ParseError); result.Token != ")" || result.Position != 3 {
+		t.Errorf("Expected: ')' at 3\tActual: '%s' at %d", result.Token, result.Position)
+	}
+
+	if _, err = Parse(`=`); err == nil {
+		t.Errorf("Expected: ParseError\tActual: nil")
+	}
+
+	if formula := NewFormula(`=SUM(1,`); formula.GetEntryNode() != nil {
+		t.Errorf("Expected: nil entry node\tActual: %v", formula.GetEntryNode())
+	}
+}
+
+func TestParse(t *testing.T) {
+	formula, err := Parse(`=IF(A1,,2)`)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+	if result := formula.GetEntryNode().ChildCount(); result != 3 {
+		t.Errorf("Expected: 3\tActual: %v", result)
+	}
+	if result := formula.GetEntryNode().ChildAt(1).NodeType(); result != NodeTypeMissing {
+		t.Errorf("Expected: omitted argument\tActual: %v", result)
+	}
+	formula, _ = Parse(`=IF(A1,"",2)`)
+	if result := formula.GetEntryNode().ChildAt(1).NodeType(); result != NodeTypeLiteral {
+		t.Errorf("Expected: Literal\tActual: %v", result)
+	}
+
+	formula, _ = Parse(`=10 + 3 * 2`)
+	entry := formula.GetEntryNode()
+	if result := entry.Value(); result != "+" {
+		t.Errorf("Expected: +\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Value(); result != "*" {
+		t.Errorf("Expected: *\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).parent; result != entry {
+		t.Errorf("Expected: parent linked\tActual: %v", result)
+	}
+}
+
+func TestPrefixOperator(t *testing.T) {
+	var formula *Formula
+
+	formula = NewFormula(`=-B2*3`)
+	entry := formula.GetEntryNode()
+	if result := entry.Value(); result != "*" {
+		t.Errorf("POSTFIX: ((B2)- 3)*. Expected: *\tActual: %v", result)
+	}
+	if result := entry.FirstChild().NodeType(); result != NodeTypePrefix {
+		t.Errorf("POSTFIX: ((B2)- 3)*. Expected: NodeTypePrefix\tActual: %v", result)
+	}
+	if result := entry.FirstChild().FirstChild().Value(); result != "B2" {
+		t.Errorf("POSTFIX: ((B2)- 3)*. Expected: B2\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=1 + -2`)
+	entry = formula.GetEntryNode()
+	if result := entry.ChildAt(1).NodeType(); result != NodeTypePrefix {
+		t.Errorf("POSTFIX: (1 (2)-)+. Expected: NodeTypePrefix\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=--A1`)
+	entry = formula.GetEntryNode()
+	if result := entry.FirstChild().NodeType(); result != NodeTypePrefix {
+		t.Errorf("POSTFIX: ((A1)-)-. Expected: NodeTypePrefix\tActual: %v", result)
+	}
+}
+
+func TestExponentOperator(t *testing.T) {
+	var formula *Formula
+
+	formula = NewFormula(`=2^3*4`)
+	entry := formula.GetEntryNode()
+	if result := entry.Value(); result != "*" {
+		t.Errorf("POSTFIX: ((2 3)^ 4)*. Expected: *\tActual: %v", result)
+	}
+	if result := entry.FirstChild().Value(); result != "^" {
+		t.Errorf("POSTFIX: ((2 3)^ 4)*. Expected: ^\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=-2^2`)
+	entry = formula.GetEntryNode()
+	if result := entry.NodeType(); result != NodeTypePrefix {
+		t.Errorf("POSTFIX: ((2 2)^)-. Expected: NodeTypePrefix\tActual: %v", result)
+	}
+	if result := entry.FirstChild().Value(); result != "^" {
+		t.Errorf("POSTFIX: ((2 2)^)-. Expected: ^\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=(1+A1)^-B1`)
+	entry = formula.GetEntryNode()
+	if result := entry.Value(); result != "^" {
+		t.Errorf("POSTFIX: ((1 A1)+ (B1)-)^. Expected: ^\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).NodeType(); result != NodeTypePrefix {
+		t.Errorf("POSTFIX: ((1 A1)+ (B1)-)^. Expected: NodeTypePrefix\tActual: %v", result)
+	}
+}
+
+func TestConcatOperator(t *testing.T) {
+	var formula *Formula
+
+	formula = NewFormula(`="Plan "&B16+1&"!"`)
+	entry := formula.GetEntryNode()
+	if result := entry.Value(); result != "&" {
+		t.Errorf("POSTFIX: (Plan (B16 1)+ !)&. Expected: &\tActual: %v", result)
+	}
+	if result := entry.ChildCount(); result != 3 {
+		t.Errorf("POSTFIX: (Plan (B16 1)+ !)&. Expected: 3\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Value(); result != "+" {
+		t.Errorf("POSTFIX: (Plan (B16 1)+ !)&. Expected: +\tActual: %v", result)
+	}
+}
+
+func TestComparisonPrecedence(t *testing.T) {
+	var formula *Formula
+
+	formula = NewFormula(`=A1+1>B1`)
+	entry := formula.GetEntryNode()
+	if result := entry.Value(); result != ">" {
+		t.Errorf("POSTFIX: ((A1 1)+ B1)>. Expected: >\tActual: %v", result)
+	}
+	if result := entry.FirstChild().Value(); result != "+" {
+		t.Errorf("POSTFIX: ((A1 1)+ B1)>. Expected: +\tActual: %v", result)
+	}
+
+	formula = NewFormula(`="a"&"b"<>A1`)
+	entry = formula.GetEntryNode()
+	if result := entry.Value(); result != "<>" {
+		t.Errorf("POSTFIX: ((a b)& A1)<>. Expected: <>\tActual: %v", result)
+	}
+	if result := entry.ChildCount(); result != 2 {
+		t.Errorf("POSTFIX: ((a b)& A1)<>. Expected: 2\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=1<2<3`)
+	entry = formula.GetEntryNode()
+	if result := entry.FirstChild().Value(); result != "<" {
+		t.Errorf("POSTFIX: ((1 2)< 3)<. Expected: <\tActual: %v", result)
+	}
+	if result := entry.ChildCount(); result != 2 {
+		t.Errorf("POSTFIX: ((1 2)< 3)<. Expected: 2\tActual: %v", result)
+	}
+}
+
+func TestPostfixOperator(t *testing.T) {
+	var formula *Formula
+
+	formula = NewFormula(`=B4*15%`)
+	entry := formula.GetEntryNode()
+	if result := entry.Value(); result != "*" {
+		t.Errorf("POSTFIX: (B4 (15)%%)*. Expected: *\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).NodeType(); result != NodeTypePostfix {
+		t.Errorf("POSTFIX: (B4 (15)%%)*. Expected: NodeTypePostfix\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Value(); result != "%" {
+		t.Errorf("POSTFIX: (B4 (15)%%)*. Expected: %%\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=-50%^2`)
+	entry = formula.GetEntryNode()
+	if result := entry.FirstChild().FirstChild().NodeType(); result != NodeTypePostfix {
+		t.Errorf("POSTFIX: (((50)%% 2)^)-. Expected: NodeTypePostfix\tActual: %v", result)
+	}
+}
+
+func TestErrorLiteral(t *testing.T) {
+	formula := NewFormula(`=IFERROR(#DIV/0!, 1)`)
+	if result := formula.GetEntryNode().FirstChild().NodeType(); result != NodeTypeError {
+		t.Errorf("Expected: NodeTypeError\tActual: %v", result)
+	}
+	if result := formula.GetEntryNode().FirstChild().Value(); result != "#DIV/0!" {
+		t.Errorf("Expected: #DIV/0!\tActual: %v", result)
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	var formula *Formula
+	var err error
+
+	formula = NewFormula(`=SUM({1,2;3,-4})`)
+	array := formula.GetEntryNode().FirstChild()
+	if result := array.NodeType(); result != NodeTypeArray {
+		t.Errorf("Expected: NodeTypeArray\tActual: %v", result)
+	}
+	if result := array.ChildCount(); result != 2 {
+		t.Errorf("Expected: 2 rows\tActual: %v", result)
+	}
+	if result := array.ChildAt(1).NodeType(); result != NodeTypeArrayRow {
+		t.Errorf("Expected: NodeTypeArrayRow\tActual: %v", result)
+	}
+	if result := array.ChildAt(1).ChildAt(1).Value(); result != -4.0 {
+		t.Errorf("Expected: -4\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=VLOOKUP(A1,{0,"Low";100,"High"},2,TRUE)`)
+	array = formula.GetEntryNode().ChildAt(1)
+	if result := array.ChildAt(1).ChildAt(1).Value(); result != "High" {
+		t.Errorf("Expected: High\tActual: %v", result)
+	}
+
+	if _, err = Parse(`={1,2;3}`); err == nil {
+		t.Errorf("Expected: ParseError for ragged array")
+	}
+	if _, err = Parse(`={1,A1}`); err == nil {
+		t.Errorf("Expected: ParseError for reference in array")
+	}
+	if _, err = Parse(`={}`); err == nil {
+		t.Errorf("Expected: ParseError for empty array")
+	}
+}
+
+func TestRangeOperators(t *testing.T) {
+	var formula *Formula
+
+	formula = NewFormula(`=SUM((A1:A5,C1:C5))`)
+	entry := formula.GetEntryNode().FirstChild().FirstChild()
+	if result := entry.Value(); result != "," {
+		t.Errorf("POSTFIX: (A1:A5 C1:C5),. Expected: ,\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Value(); result != "C1:C5" {
+		t.Errorf("POSTFIX: (A1:A5 C1:C5),. Expected: C1:C5\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=B1:D5 C3:C9`)
+	entry = formula.GetEntryNode()
+	if result := entry.Value(); result != " " {
+		t.Errorf("POSTFIX: (B1:D5 C3:C9)' '. Expected: ' '\tActual: %v", result)
+	}
+	if result := entry.ChildCount(); result != 2 {
+		t.Errorf("POSTFIX: (B1:D5 C3:C9)' '. Expected: 2\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=-(A1,B2) C3+1`)
+	entry = formula.GetEntryNode()
+	if result := entry.FirstChild().FirstChild().Value(); result != " " {
+		t.Errorf("POSTFIX: (((A1 B2), C3)' ')- 1)+. Expected: ' '\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=SUM(Input!Age:B5)`)
+	entry = formula.GetEntryNode().FirstChild()
+	if result := entry.Value(); result != ":" {
+		t.Errorf("POSTFIX: (Input!Age Input!B5):. Expected: :\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Value(); result != "Input!B5" {
+		t.Errorf("POSTFIX: (Input!Age Input!B5):. Expected: Input!B5\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=SUM(A1:(B2))`)
+	entry = formula.GetEntryNode().FirstChild()
+	if result := entry.Value(); result != ":" {
+		t.Errorf("POSTFIX: (A1 (B2)IDENTITY):. Expected: :\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Value(); result != "IDENTITY" {
+		t.Errorf("POSTFIX: (A1 (B2)IDENTITY):. Expected: IDENTITY\tActual: %v", result)
+	}
+
+	formula = NewFormula(`=A1:INDEX(B1:B5,2)`)
+	entry = formula.GetEntryNode()
+	if result := entry.ChildAt(1).Value(); result != "INDEX" {
+		t.Errorf("POSTFIX: (A1 (B1:B5 2)INDEX):. Expected: INDEX\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).ChildCount(); result != 2 {
+		t.Errorf("POSTFIX: (A1 (B1:B5 2)INDEX):. Expected: 2\tActual: %v", result)
+	}
+}
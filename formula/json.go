@@ -0,0 +1,214 @@
+package formula
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// nodeTypeNames Names of node types as written in JSON
+var nodeTypeNames = map[NodeType]string{
+	NodeTypeRoot:     "Root",
+	NodeTypeLiteral:  "Literal",
+	NodeTypeInteger:  "Integer",
+	NodeTypeFloat:    "Float",
+	NodeTypeRef:      "Ref",
+	NodeTypeFunc:     "Func",
+	NodeTypeOperator: "Operator",
+	NodeTypePrefix:   "Prefix",
+	NodeTypePostfix:  "Postfix",
+	NodeTypeError:    "Error",
+	NodeTypeArray:    "Array",
+	NodeTypeArrayRow: "ArrayRow",
+	NodeTypeBoolean:  "Boolean",
+	NodeTypeMissing:  "Missing",
+}
+
+// String Name of the node type, e.g. Ref
+func (nodeType NodeType) String() string {
+	if name, ok := nodeTypeNames[nodeType]; ok {
+		return name
+	}
+	return fmt.Sprintf("NodeType(%d)", int8(nodeType))
+}
+
+// MarshalJSON Encode the node type by name
+func (nodeType NodeType) MarshalJSON() ([]byte, error) {
+	if _, ok := nodeTypeNames[nodeType]; !ok {
+		return nil, fmt.Errorf("Unknown node type %d", int8(nodeType))
+	}
+	return json.Marshal(nodeType.String())
+}
+
+// UnmarshalJSON Decode a node type from its name
+func (nodeType *NodeType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for candidate, candidateName := range nodeTypeNames {
+		if candidateName == name {
+			*nodeType = candidate
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown node type %s", name)
+}
+
+// nodeJSON Wire format of a Node
+type nodeJSON struct {
+	Type     NodeType    `json:"type"`
+	Value    interface{} `json:"value"`
+	Span     Span        `json:"span"`
+	Children []*Node     `json:"children,omitempty"`
+}
+
+// formulaJSON Wire format of a Formula. Text is informative only, the entry
+// node is what gets loaded back
+type formulaJSON struct {
+	Text  string `json:"text"`
+	Entry *Node  `json:"entry"`
+}
+
+// MarshalJSON Encode the node and everything under it, e.g. for =SUM(A1:B2)
+// {"type":"Func","value":"SUM","span":{"start":1,"end":11},"children":[...]}
+func (node *Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nodeJSON{
+		Type:     node.nodeType,
+		Value:    node.value,
+		Span:     node.span,
+		Children: node.children,
+	})
+}
+
+// UnmarshalJSON Decode a node and its children, restoring their parents
+func (node *Node) UnmarshalJSON(data []byte) error {
+	var decoded nodeJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	value, err := nodeValue(decoded.Type, decoded.Value)
+	if err != nil {
+		return err
+	}
+
+	*node = Node{
+		value:    value,
+		nodeType: decoded.Type,
+		span:     decoded.Span,
+	}
+	for _, child := range decoded.Children {
+		if child == nil {
+			return fmt.Errorf("Missing child of %s node", decoded.Type)
+		}
+		node.appendChild(child)
+	}
+	return node.checkShape()
+}
+
+// checkShape Check a decoded node has the children its type needs, the
+// engine takes the shape of parsed trees for granted
+func (node *Node) checkShape() error {
+	count := len(node.children)
+	if node.nodeType != NodeTypeArray {
+		for _, child := range node.children {
+			if !child.isOperand() {
+				return fmt.Errorf("%s node cannot hold a %s node", node.nodeType, child.nodeType)
+			}
+		}
+	}
+
+	switch node.nodeType {
+	case NodeTypeFunc:
+		if node.value == "IDENTITY" && count != 1 {
+			return fmt.Errorf("IDENTITY node needs 1 child, has %d", count)
+		}
+	case NodeTypePrefix, NodeTypePostfix:
+		if count != 1 {
+			return fmt.Errorf("%s node needs 1 child, has %d", node.nodeType, count)
+		}
+	case NodeTypeOperator:
+		if count < 2 {
+			return fmt.Errorf("Operator node needs 2 children or more, has %d", count)
+		}
+	case NodeTypeArray:
+		if count == 0 {
+			return fmt.Errorf("Array node needs 1 row or more")
+		}
+		for _, row := range node.children {
+			if row.nodeType != NodeTypeArrayRow || len(row.children) != len(node.children[0].children) {
+				return fmt.Errorf("Array node needs ArrayRow children of equal length")
+			}
+		}
+	case NodeTypeArrayRow:
+		if count == 0 {
+			return fmt.Errorf("ArrayRow node needs 1 element or more")
+		}
+		for _, element := range node.children {
+			switch element.nodeType {
+			case NodeTypeLiteral, NodeTypeFloat, NodeTypeBoolean, NodeTypeError:
+			default:
+				return fmt.Errorf("ArrayRow node holds constants only, not %s", element.nodeType)
+			}
+		}
+	default:
+		if count > 0 {
+			return fmt.Errorf("%s node takes no children", node.nodeType)
+		}
+	}
+	return nil
+}
+
+// isOperand Whether a decoded node may stand as the entry node or as an
+// argument, array rows only stand inside arrays
+func (node *Node) isOperand() bool {
+	return node.nodeType != NodeTypeArrayRow && node.nodeType != NodeTypeRoot
+}
+
+// nodeValue Convert a decoded JSON value to what the parser stores for the
+// node type, JSON numbers all come back as float64. The parser reads every
+// number as Float, Integer nodes are refused as the engine does not take them
+func nodeValue(nodeType NodeType, value interface{}) (interface{}, error) {
+	switch nodeType {
+	case NodeTypeFloat:
+		if number, ok := value.(float64); ok {
+			return number, nil
+		}
+	case NodeTypeInteger:
+		return nil, fmt.Errorf("Integer node %v is not supported, numbers are Float nodes", value)
+	case NodeTypeBoolean:
+		if boolean, ok := value.(bool); ok {
+			return boolean, nil
+		}
+	default:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid value %v for %s node", value, nodeType)
+}
+
+// MarshalJSON Encode the formula text and its tree
+func (formula *Formula) MarshalJSON() ([]byte, error) {
+	return json.Marshal(formulaJSON{
+		Text:  formula.Format(),
+		Entry: formula.GetEntryNode(),
+	})
+}
+
+// UnmarshalJSON Load a formula from its tree without parsing the text
+func (formula *Formula) UnmarshalJSON(data []byte) error {
+	var decoded formulaJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	formula.root = newNode(NodeTypeRoot, "root")
+	if decoded.Entry != nil {
+		if !decoded.Entry.isOperand() {
+			return fmt.Errorf("%s node cannot be the entry node", decoded.Entry.nodeType)
+		}
+		formula.root.appendChild(decoded.Entry)
+	}
+	return nil
+}
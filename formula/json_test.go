@@ -0,0 +1,107 @@
+package formula
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	formula := NewFormula(`=SUM(A1:B2, 1.5)`)
+
+	data, err := json.Marshal(formula)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"text":"=SUM(A1:B2,1.5)","entry":{"type":"Func","value":"SUM","span":{"start":1,"end":16},"children":[` +
+		`{"type":"Ref","value":"A1:B2","span":{"start":5,"end":10}},{"type":"Float","value":1.5,"span":{"start":12,"end":15}}]}}`
+	if string(data) != expected {
+		t.Errorf("Expected: %s\tActual: %s", expected, data)
+	}
+
+	data, _ = json.Marshal(NewFormula(`=SUM(1,`))
+	if string(data) != `{"text":"","entry":null}` {
+		t.Errorf("Expected: null entry\tActual: %s", data)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	texts := []string{
+		`=IF(A1>=10,TRUE,"no")`,
+		`=-B4*15%+'Rate Table'!$A$1`,
+		`={1,-2;"a",FALSE}`,
+		`=IFERROR(1/0,#DIV/0!)`,
+		`=SUM((A1:A5,C1:C5)) & B1:D5 C3:C9`,
+		`=IF(A1,,"")`,
+	}
+	for _, text := range texts {
+		data, err := json.Marshal(NewFormula(text))
+		if err != nil {
+			t.Errorf("%s Expected: JSON\tActual: %v", text, err)
+			continue
+		}
+
+		var formula Formula
+		if err = json.Unmarshal(data, &formula); err != nil {
+			t.Errorf("%s Expected: formula\tActual: %v", text, err)
+		} else if result := formula.String(); result != NewFormula(text).String() {
+			t.Errorf("%s Expected: %s\tActual: %s", text, NewFormula(text), result)
+		}
+	}
+
+	var formula Formula
+	json.Unmarshal([]byte(`{"entry":{"type":"Operator","value":"+","children":[{"type":"Float","value":1},{"type":"Boolean","value":true}]}}`), &formula)
+	entry := formula.GetEntryNode()
+	if result := entry.ChildAt(1).Value(); result != true {
+		t.Errorf("Expected: true\tActual: %v", result)
+	}
+	if result := entry.ChildAt(1).Parent(); result != entry {
+		t.Errorf("Expected: %v\tActual: %v", entry, result)
+	}
+	if result := entry.Parent(); result != nil {
+		t.Errorf("Expected: nil\tActual: %v", result)
+	}
+	formula = Formula{}
+	json.Unmarshal([]byte(`{"entry":{"type":"Ref","value":"B1","span":{"start":4,"end":6}}}`), &formula)
+	if result := formula.GetEntryNode().Span(); result != (Span{Start: 4, End: 6}) {
+		t.Errorf("Expected: {4 6}\tActual: %v", result)
+	}
+}
+
+func TestUnmarshalInvalidJSON(t *testing.T) {
+	invalid := []string{
+		`{"entry":{"type":"Nope","value":"x"}}`,
+		`{"entry":{"type":"Float","value":"x"}}`,
+		`{"entry":{"type":"Func","value":"SUM","children":[null]}}`,
+		`{"entry":{"type":3}}`,
+		`{"entry":{"type":"Prefix","value":"-"}}`,
+		`{"entry":{"type":"Postfix","value":"%","children":[{"type":"Float","value":1},{"type":"Float","value":2}]}}`,
+		`{"entry":{"type":"Operator","value":"+"}}`,
+		`{"entry":{"type":"Operator","value":"+","children":[{"type":"Float","value":1}]}}`,
+		`{"entry":{"type":"Func","value":"IDENTITY"}}`,
+		`{"entry":{"type":"Array","value":"ARRAY"}}`,
+		`{"entry":{"type":"Array","value":"ARRAY","children":[{"type":"Float","value":1}]}}`,
+		`{"entry":{"type":"Array","value":"ARRAY","children":[{"type":"ArrayRow","value":"ARRAYROW"}]}}`,
+		`{"entry":{"type":"Array","value":"ARRAY","children":[` +
+			`{"type":"ArrayRow","value":"ARRAYROW","children":[{"type":"Float","value":1},{"type":"Float","value":2}]},` +
+			`{"type":"ArrayRow","value":"ARRAYROW","children":[{"type":"Float","value":3}]}]}}`,
+		`{"entry":{"type":"Array","value":"ARRAY","children":[` +
+			`{"type":"ArrayRow","value":"ARRAYROW","children":[{"type":"Ref","value":"A1"}]}]}}`,
+		`{"entry":{"type":"Float","value":1,"children":[{"type":"Float","value":2}]}}`,
+		`{"entry":{"type":"Integer","value":3}}`,
+		`{"entry":{"type":"Func","value":"SUM","children":[{"type":"Integer","value":3},{"type":"Float","value":2}]}}`,
+		`{"entry":{"type":"Operator","value":"+","children":[{"type":"Integer","value":3},{"type":"Float","value":2}]}}`,
+		`{"entry":{"type":"Array","value":"ARRAY","children":[` +
+			`{"type":"ArrayRow","value":"ARRAYROW","children":[{"type":"Integer","value":1}]}]}}`,
+		`{"entry":{"type":"ArrayRow","value":"ARRAYROW","children":[{"type":"Float","value":1}]}}`,
+		`{"entry":{"type":"Func","value":"SUM","children":[` +
+			`{"type":"ArrayRow","value":"ARRAYROW","children":[{"type":"Float","value":1}]}]}}`,
+		`{"entry":{"type":"Root","value":"root"}}`,
+		`{"entry":{"type":"Operator","value":"+","children":[{"type":"Root","value":"root"},{"type":"Float","value":2}]}}`,
+	}
+	for _, data := range invalid {
+		var formula Formula
+		if err := json.Unmarshal([]byte(data), &formula); err == nil {
+			t.Errorf("%s Expected: error\tActual: %v", data, formula.String())
+		}
+	}
+}
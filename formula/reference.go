@@ -0,0 +1,325 @@
+package formula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxCols Number of columns in a worksheet, A to XFD
+	MaxCols = 16384
+	// MaxRows Number of rows in a worksheet
+	MaxRows = 1048576
+)
+
+// CellRef Zero based coordinates of one corner of a reference
+type CellRef struct {
+	Col int
+	Row int
+	// ColAbsolute Column written with $, e.g. $A1
+	ColAbsolute bool
+	// RowAbsolute Row written with $, e.g. A$1
+	RowAbsolute bool
+}
+
+// Reference Parsed cell or range address, e.g. Sheet1!$A$1:B2
+type Reference struct {
+	// Sheet Name of the sheet, empty when relative to the host sheet
+	Sheet string
+	// LastSheet Name of the last sheet of a 3D reference, e.g. Dec in
+	// Jan:Dec!B5, empty otherwise
+	LastSheet string
+	From      CellRef
+	To        CellRef
+}
+
+// ParseReference Parse an A1 style address as written in formulas
+func ParseReference(text string) (ref Reference, err error) {
+	var address string
+	if ref.Sheet, address, err = splitSheet(text); err != nil {
+		return
+	}
+	// Sheet names cannot contain colons, so one marks a 3D reference
+	if index := strings.Index(ref.Sheet, ":"); index >= 0 {
+		ref.Sheet, ref.LastSheet = ref.Sheet[:index], ref.Sheet[index+1:]
+		if ref.Sheet == "" || ref.LastSheet == "" || strings.Contains(ref.LastSheet, ":") {
+			err = fmt.Errorf("Invalid reference %s", text)
+			return
+		}
+	}
+
+	corners := strings.Split(address, ":")
+	if len(corners) > 2 {
+		err = fmt.Errorf("Invalid reference %s", text)
+		return
+	}
+
+	if len(corners) == 1 {
+		if ref.From, err = parseCellRef(corners[0]); err != nil {
+			err = fmt.Errorf("Invalid reference %s", text)
+			return
+		}
+		ref.To = ref.From
+	} else if ref.From, ref.To, err = parseCorners(corners[0], corners[1]); err != nil {
+		err = fmt.Errorf("Invalid reference %s", text)
+		return
+	}
+
+	// B2:A1 is the same range as A1:B2
+	if ref.From.Col > ref.To.Col {
+		ref.From.Col, ref.To.Col = ref.To.Col, ref.From.Col
+		ref.From.ColAbsolute, ref.To.ColAbsolute = ref.To.ColAbsolute, ref.From.ColAbsolute
+	}
+	if ref.From.Row > ref.To.Row {
+		ref.From.Row, ref.To.Row = ref.To.Row, ref.From.Row
+		ref.From.RowAbsolute, ref.To.RowAbsolute = ref.To.RowAbsolute, ref.From.RowAbsolute
+	}
+	return
+}
+
+// splitSheet Split the sheet name off an address. Names may be quoted the way
+// Excel writes them, with a doubled apostrophe for each one in the name.
+// Unquoted names cannot hold a !, Input!B2:Input!D2 is two references
+func splitSheet(text string) (sheet string, address string, err error) {
+	if !strings.HasPrefix(text, "'") {
+		index := strings.Index(text, "!")
+		if index < 0 {
+			return "", text, nil
+		} else if index == 0 || strings.Contains(text[index+1:], "!") {
+			return "", "", fmt.Errorf("Invalid reference %s", text)
+		}
+		return text[:index], text[index+1:], nil
+	}
+
+	var name []byte
+	for index := 1; index < len(text); index++ {
+		if text[index] != '\'' {
+			name = append(name, text[index])
+		} else if index+1 < len(text) && text[index+1] == '\'' {
+			name = append(name, '\'')
+			index++
+		} else if index+1 < len(text) && text[index+1] == '!' && len(name) > 0 {
+			return string(name), text[index+2:], nil
+		} else {
+			break
+		}
+	}
+	return "", "", fmt.Errorf("Invalid sheet name in reference %s", text)
+}
+
+// QuoteSheetName Sheet name as written in a formula, quoted when it contains
+// anything other than letters, digits, underscores and periods
+func QuoteSheetName(sheet string) string {
+	plain := sheet != "" && (sheet[0] < '0' || sheet[0] > '9')
+	for _, letter := range sheet {
+		if !unicode.IsLetter(letter) && !unicode.IsDigit(letter) && letter != '_' && letter != '.' {
+			plain = false
+			break
+		}
+	}
+	if _, err := parseCellRef(sheet); plain && err != nil {
+		// Names such as A1 would read as a cell
+		return sheet
+	}
+	return "'" + strings.Replace(sheet, "'", "''", -1) + "'"
+}
+
+// quoteSheets Sheets of a 3D reference as written in a formula. Excel quotes
+// both as one, 'Jan 1:Dec 31'!B5
+func quoteSheets(sheet string, lastSheet string) string {
+	sheets := sheet + ":" + lastSheet
+	if QuoteSheetName(sheet) != sheet || QuoteSheetName(lastSheet) != lastSheet {
+		sheets = "'" + strings.Replace(sheets, "'", "''", -1) + "'"
+	}
+	return sheets
+}
+
+// parseCorners Parse both corners of a range. Whole columns (A:C) span every
+// row and whole rows (1:3) span every column
+func parseCorners(fromText string, toText string) (from CellRef, to CellRef, err error) {
+	var fromIndex, toIndex int
+	if from, fromIndex, err = parseColumn(fromText); err != nil {
+		return
+	}
+	if to, toIndex, err = parseColumn(toText); err != nil {
+		return
+	}
+
+	if fromIndex == len(fromText) && toIndex == len(toText) {
+		if fromIndex == 0 || toIndex == 0 {
+			err = fmt.Errorf("Missing column %s:%s", fromText, toText)
+			return
+		}
+		from.Row, to.Row = 0, MaxRows-1
+		return
+	} else if fromIndex == 0 && toIndex == 0 {
+		if from.Row, from.RowAbsolute, err = parseRow(fromText); err != nil {
+			return
+		}
+		to.Row, to.RowAbsolute, err = parseRow(toText)
+		from.Col, to.Col = 0, MaxCols-1
+		return
+	}
+
+	if from, err = parseCellRef(fromText); err != nil {
+		return
+	}
+	to, err = parseCellRef(toText)
+	return
+}
+
+// parseCellRef Parse a single cell address such as $A$1
+func parseCellRef(text string) (cell CellRef, err error) {
+	var index int
+	if cell, index, err = parseColumn(text); err != nil {
+		return
+	}
+	if index == 0 || index == len(text) {
+		err = fmt.Errorf("Invalid cell %s", text)
+		return
+	}
+
+	cell.Row, cell.RowAbsolute, err = parseRow(text[index:])
+	return
+}
+
+// parseColumn Parse the optional $ and column letters at the start of an
+// address. index is where the column ends, zero when there are no letters
+func parseColumn(text string) (cell CellRef, index int, err error) {
+	if index < len(text) && text[index] == '$' {
+		cell.ColAbsolute = true
+		index++
+	}
+
+	col := 0
+	start := index
+	for ; index < len(text); index++ {
+		letter := text[index]
+		if letter >= 'a' && letter <= 'z' {
+			letter -= 'a' - 'A'
+		}
+		if letter < 'A' || letter > 'Z' {
+			break
+		}
+		col = col*26 + int(letter-'A') + 1
+		if col > MaxCols {
+			err = fmt.Errorf("Column out of bounds %s", text)
+			return
+		}
+	}
+	if index == start {
+		// No letters, a leading $ belongs to the row
+		return CellRef{}, 0, nil
+	}
+
+	cell.Col = col - 1
+	return
+}
+
+// parseRow Parse the optional $ and row number at the end of an address
+func parseRow(text string) (row int, absolute bool, err error) {
+	if strings.HasPrefix(text, "$") {
+		absolute = true
+		text = text[1:]
+	}
+
+	number, convErr := strconv.Atoi(text)
+	if convErr != nil || number < 1 || number > MaxRows || text[0] == '+' || text[0] == '-' {
+		err = fmt.Errorf("Invalid row %s", text)
+		return
+	}
+	row = number - 1
+	return
+}
+
+// ColumnName Letters of a zero based column index, e.g. 27 is AB
+func ColumnName(col int) string {
+	var letters []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		letters = append([]byte{byte('A' + (col-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+// Intersect Cells two references on the same sheet have in common, ok is
+// false when there are none
+func (ref Reference) Intersect(other Reference) (result Reference, ok bool) {
+	result = ref
+	if other.From.Col > result.From.Col {
+		result.From.Col = other.From.Col
+	}
+	if other.From.Row > result.From.Row {
+		result.From.Row = other.From.Row
+	}
+	if other.To.Col < result.To.Col {
+		result.To.Col = other.To.Col
+	}
+	if other.To.Row < result.To.Row {
+		result.To.Row = other.To.Row
+	}
+
+	ok = ref.Sheet == other.Sheet && result.From.Col <= result.To.Col && result.From.Row <= result.To.Row
+	return
+}
+
+// Span Smallest range on the sheet covering both references, as in A1:B2:C3
+func (ref Reference) Span(other Reference) (result Reference) {
+	result = ref
+	if other.From.Col < result.From.Col {
+		result.From.Col = other.From.Col
+	}
+	if other.From.Row < result.From.Row {
+		result.From.Row = other.From.Row
+	}
+	if other.To.Col > result.To.Col {
+		result.To.Col = other.To.Col
+	}
+	if other.To.Row > result.To.Row {
+		result.To.Row = other.To.Row
+	}
+	return
+}
+
+// IsWholeColumn Checks if the reference spans every row, e.g. A:C
+func (ref Reference) IsWholeColumn() bool {
+	return ref.From.Row == 0 && ref.To.Row == MaxRows-1
+}
+
+// IsWholeRow Checks if the reference spans every column, e.g. 1:3
+func (ref Reference) IsWholeRow() bool {
+	return ref.From.Col == 0 && ref.To.Col == MaxCols-1
+}
+
+// IsRange Checks if the reference spans more than one cell
+func (ref Reference) IsRange() bool {
+	return ref.From.Col != ref.To.Col || ref.From.Row != ref.To.Row
+}
+
+// String Address without absolute markers, suitable as a lookup key
+func (ref Reference) String() string {
+	var address string
+	if ref.IsWholeColumn() && !ref.IsWholeRow() {
+		address = ColumnName(ref.From.Col) + ":" + ColumnName(ref.To.Col)
+	} else if ref.IsWholeRow() && !ref.IsWholeColumn() {
+		address = strconv.Itoa(ref.From.Row+1) + ":" + strconv.Itoa(ref.To.Row+1)
+	} else if ref.IsRange() {
+		address = ref.From.String() + ":" + ref.To.String()
+	} else {
+		address = ref.From.String()
+	}
+
+	if ref.Sheet == "" {
+		return address
+	} else if ref.LastSheet == "" {
+		return QuoteSheetName(ref.Sheet) + "!" + address
+	}
+
+	return quoteSheets(ref.Sheet, ref.LastSheet) + "!" + address
+}
+
+// String Address without absolute markers, e.g. A1
+func (cell CellRef) String() string {
+	return ColumnName(cell.Col) + strconv.Itoa(cell.Row+1)
+}
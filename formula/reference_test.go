@@ -0,0 +1,125 @@
+package formula
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	expectations := map[string]Reference{
+		`A1`:                   {From: CellRef{Col: 0, Row: 0}, To: CellRef{Col: 0, Row: 0}},
+		`$B$2`:                 {From: CellRef{Col: 1, Row: 1, ColAbsolute: true, RowAbsolute: true}, To: CellRef{Col: 1, Row: 1, ColAbsolute: true, RowAbsolute: true}},
+		`B$2`:                  {From: CellRef{Col: 1, Row: 1, RowAbsolute: true}, To: CellRef{Col: 1, Row: 1, RowAbsolute: true}},
+		`$B2`:                  {From: CellRef{Col: 1, Row: 1, ColAbsolute: true}, To: CellRef{Col: 1, Row: 1, ColAbsolute: true}},
+		`Input!AB10`:           {Sheet: "Input", From: CellRef{Col: 27, Row: 9}, To: CellRef{Col: 27, Row: 9}},
+		`A1:$C$3`:              {From: CellRef{Col: 0, Row: 0}, To: CellRef{Col: 2, Row: 2, ColAbsolute: true, RowAbsolute: true}},
+		`C3:A1`:                {From: CellRef{Col: 0, Row: 0}, To: CellRef{Col: 2, Row: 2}},
+		`'Rate Table'!B2`:      {Sheet: "Rate Table", From: CellRef{Col: 1, Row: 1}, To: CellRef{Col: 1, Row: 1}},
+		`'Bob''s'!A1`:          {Sheet: "Bob's", From: CellRef{Col: 0, Row: 0}, To: CellRef{Col: 0, Row: 0}},
+		`'A!B'!C1`:             {Sheet: "A!B", From: CellRef{Col: 2, Row: 0}, To: CellRef{Col: 2, Row: 0}},
+		`Rate Table!B2`:        {Sheet: "Rate Table", From: CellRef{Col: 1, Row: 1}, To: CellRef{Col: 1, Row: 1}},
+		`Jan:Dec!B5`:           {Sheet: "Jan", LastSheet: "Dec", From: CellRef{Col: 1, Row: 4}, To: CellRef{Col: 1, Row: 4}},
+		`'Jan 1:Dec 31'!A1:B2`: {Sheet: "Jan 1", LastSheet: "Dec 31", From: CellRef{Col: 0, Row: 0}, To: CellRef{Col: 1, Row: 1}},
+		`A:A`:                  {From: CellRef{Col: 0, Row: 0}, To: CellRef{Col: 0, Row: MaxRows - 1}},
+		`Rates!$D:b`:           {Sheet: "Rates", From: CellRef{Col: 1, Row: 0}, To: CellRef{Col: 3, Row: MaxRows - 1, ColAbsolute: true}},
+		`3:$3`:                 {From: CellRef{Col: 0, Row: 2}, To: CellRef{Col: MaxCols - 1, Row: 2, RowAbsolute: true}},
+	}
+	for text, expected := range expectations {
+		ref, err := ParseReference(text)
+		if err != nil {
+			t.Errorf("%s Expected: %v\tActual: %v", text, expected, err)
+		} else if ref != expected {
+			t.Errorf("%s Expected: %+v\tActual: %+v", text, expected, ref)
+		}
+	}
+}
+
+func TestParseInvalidReference(t *testing.T) {
+	for _, text := range []string{``, `A`, `1`, `A0`, `A-1`, `XFE1`, `A1048577`, `!A1`, `A1:B2:C3`, `A1B`, `Sheet 1!b2:c`, `'Rates!A1`, `'Rates'A1`, `''!A1`, `'Bob's'!A1`, `A1:B`, `A:1`, `:A`, `A$:B`, `$1:2$`, `0:1`, `:Dec!B5`, `Jan:!B5`, `Jan:Feb:Mar!B5`, `Input!B2:Input!D2`, `A!B!C1`} {
+		if ref, err := ParseReference(text); err == nil {
+			t.Errorf("%s Expected: error\tActual: %v", text, ref)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	expectations := map[int]string{
+		0:     "A",
+		25:    "Z",
+		26:    "AA",
+		27:    "AB",
+		701:   "ZZ",
+		702:   "AAA",
+		16383: "XFD",
+	}
+	for col, expected := range expectations {
+		if name := ColumnName(col); name != expected {
+			t.Errorf("%d Expected: %s\tActual: %s", col, expected, name)
+		}
+	}
+}
+
+func TestReferenceString(t *testing.T) {
+	expectations := map[string]string{
+		`$A$1`:           "A1",
+		`b$2:$a1`:        "A1:B2",
+		`Input!$C$3:C3`:  "Input!C3",
+		`Input!A1:XFD1`:  "Input!1:1",
+		`Rates!$A:D`:     "Rates!A:D",
+		`3:$5`:           "3:5",
+		`A:XFD`:          "A1:XFD1048576",
+		`Rate Table!B2`:  "'Rate Table'!B2",
+		`'Bob''s'!A1`:    "'Bob''s'!A1",
+		`'AB12'!A1`:      "'AB12'!A1",
+		`'2019'!A1`:      "'2019'!A1",
+		`Jan:Dec!$B$5`:   "Jan:Dec!B5",
+		`'Jan 1:Dec'!B5`: "'Jan 1:Dec'!B5",
+		`'Q1.Sales'!A1`:  "Q1.Sales!A1",
+	}
+	for text, expected := range expectations {
+		ref, _ := ParseReference(text)
+		if ref.String() != expected {
+			t.Errorf("%s Expected: %s\tActual: %s", text, expected, ref.String())
+		}
+	}
+}
+
+func TestReferenceIntersect(t *testing.T) {
+	expectations := map[string]string{
+		`B1:D5 C3:C9`:  "C3:C5",
+		`A:A 3:3`:      "A3",
+		`A1:B2 B2:C3`:  "B2",
+		`A1:B2 C3:D4`:  "",
+		`S!A1:B2 T!A1`: "",
+		`$A$1:$C$3 B2`: "B2",
+	}
+	for text, expected := range expectations {
+		var operands []Reference
+		for _, address := range strings.Split(text, " ") {
+			ref, _ := ParseReference(address)
+			operands = append(operands, ref)
+		}
+		result, ok := operands[0].Intersect(operands[1])
+		if expected == "" && ok {
+			t.Errorf("%s Expected: none\tActual: %s", text, result)
+		} else if expected != "" && (!ok || result.String() != expected) {
+			t.Errorf("%s Expected: %s\tActual: %s", text, expected, result)
+		}
+	}
+}
+
+func TestReferenceSpan(t *testing.T) {
+	expectations := map[string]string{
+		`A1 C3`:    "A1:C3",
+		`B5 C2:D3`: "B2:D5",
+		`A:A C4`:   "A:C",
+	}
+	for text, expected := range expectations {
+		addresses := strings.Split(text, " ")
+		from, _ := ParseReference(addresses[0])
+		to, _ := ParseReference(addresses[1])
+		if result := from.Span(to).String(); result != expected {
+			t.Errorf("%s Expected: %s\tActual: %s", text, expected, result)
+		}
+	}
+}
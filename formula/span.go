@@ -0,0 +1,145 @@
+package formula
+
+import (
+	"strings"
+
+	"github.com/xuri/efp"
+)
+
+// Span Byte offsets of a node in the formula text, Start inclusive and End
+// exclusive. The leading = counts, so in =A1+B1 the span of B1 is 4 to 6
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// tokenSpans Locate each efp token in the text it came from. efp keeps no
+// positions and rewrites values, e.g. 'Rate Table'!A1 loses its quotes, SUM(
+// becomes SUM and a prefix + disappears, so the text is scanned alongside
+func tokenSpans(text string, tokens []efp.Token) []Span {
+	spans := make([]Span, len(tokens))
+	position := 0
+	if strings.HasPrefix(text, "=") {
+		position = 1
+	}
+
+	// Open functions and subexpressions, true for array rows which have no
+	// parentheses of their own
+	var rows []bool
+	for i, token := range tokens {
+		intersection := token.TSubType == efp.TokenSubTypeIntersection
+		if !intersection {
+			position = skipBlanks(text, position, token)
+		}
+
+		start := position
+		switch {
+		case intersection:
+			for position < len(text) && isBlank(text[position]) {
+				position++
+			}
+		case token.TSubType == efp.TokenSubTypeStop:
+			if len(rows) == 0 || !rows[len(rows)-1] {
+				position++
+			}
+			if len(rows) > 0 {
+				rows = rows[:len(rows)-1]
+			}
+		case token.TType == efp.TokenTypeSubexpression:
+			rows = append(rows, false)
+			position++
+		case token.TType == efp.TokenTypeFunction:
+			rows = append(rows, token.TValue == "ARRAYROW")
+			if token.TValue == "ARRAY" {
+				position++
+			} else if token.TValue != "ARRAYROW" {
+				position = skipQuoted(text, position, '\'')
+				if index := strings.IndexByte(text[min(position, len(text)):], '('); index >= 0 {
+					position += index + 1
+				}
+			}
+		case token.TType == efp.TokenTypeOperand:
+			position = scanOperand(text, position, token)
+		case token.TType == efp.TokenTypeArgument:
+			position++
+		default:
+			position += len(token.TValue)
+		}
+
+		spans[i] = Span{Start: min(start, len(text)), End: min(position, len(text))}
+	}
+	return spans
+}
+
+// scanOperand Position after an operand starting at position
+func scanOperand(text string, position int, token efp.Token) int {
+	switch token.TSubType {
+	case efp.TokenSubTypeText:
+		return skipQuoted(text, position, '"')
+	case efp.TokenSubTypeNumber:
+		for position < len(text) && (isDigit(text[position]) || text[position] == '.') {
+			position++
+		}
+		if position < len(text) && (text[position] == 'E' || text[position] == 'e') {
+			position++
+			if position < len(text) && (text[position] == '+' || text[position] == '-') {
+				position++
+			}
+			for position < len(text) && isDigit(text[position]) {
+				position++
+			}
+		}
+		return position
+	case efp.TokenSubTypeError, efp.TokenSubTypeLogical:
+		return position + len(token.TValue)
+	}
+
+	// References and names run up to the next delimiter
+	position = skipQuoted(text, position, '\'')
+	for position < len(text) && !isBlank(text[position]) && !strings.ContainsRune(`+-*/^&=<>,;(){}%"`, rune(text[position])) {
+		position++
+	}
+	return position
+}
+
+// skipQuoted Position after a quoted run starting at position, a doubled
+// quote standing for one. Unchanged when there is no quote at position
+func skipQuoted(text string, position int, quote byte) int {
+	if position >= len(text) || text[position] != quote {
+		return position
+	}
+	for position++; position < len(text); position++ {
+		if text[position] != quote {
+			continue
+		} else if position+1 < len(text) && text[position+1] == quote {
+			position++
+			continue
+		}
+		return position + 1
+	}
+	return position
+}
+
+// skipBlanks Skip whitespace and any prefix + efp dropped in front of a token
+func skipBlanks(text string, position int, token efp.Token) int {
+	plus := token.TValue == "+" && (token.TType == efp.TokenTypeOperatorInfix || token.TType == efp.TokenTypeOperatorPrefix)
+	for position < len(text) && (isBlank(text[position]) || (text[position] == '+' && !plus)) {
+		position++
+	}
+	return position
+}
+
+func isBlank(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\r' || char == '\n'
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package formula
+
+import "testing"
+
+func TestSpans(t *testing.T) {
+	// Text of the node found by following child indexes from the entry node
+	expectations := []struct {
+		text     string
+		path     []int
+		expected string
+	}{
+		{`=SUM(A1:B2, 1.5)*-2`, []int{}, `SUM(A1:B2, 1.5)*-2`},
+		{`=SUM(A1:B2, 1.5)*-2`, []int{0}, `SUM(A1:B2, 1.5)`},
+		{`=SUM(A1:B2, 1.5)*-2`, []int{0, 1}, `1.5`},
+		{`=SUM(A1:B2, 1.5)*-2`, []int{1}, `-2`},
+		{`= 1 + 2 + 3`, []int{2}, `3`},
+		{`= 1 + 2 + 3`, []int{}, `1 + 2 + 3`},
+		{`=(A1 + 1) * 2`, []int{0}, `(A1 + 1)`},
+		{`=(A1 + 1) * 2`, []int{0, 0, 1}, `1`},
+		{`="a ""b"" c" & 'Rate Table'!$B$2`, []int{0}, `"a ""b"" c"`},
+		{`="a ""b"" c" & 'Rate Table'!$B$2`, []int{1}, `'Rate Table'!$B$2`},
+		{`=+5 + +A1`, []int{1}, `A1`},
+		{`=B4*15%`, []int{1}, `15%`},
+		{`=1E+20/#DIV/0!`, []int{0}, `1E+20`},
+		{`=1E+20/#DIV/0!`, []int{1}, `#DIV/0!`},
+		{`=IF(A1,,TRUE)`, []int{2}, `TRUE`},
+		{`=IF(A1,,TRUE)`, []int{1}, ``},
+		{`={1,-2;3,4}*2`, []int{0}, `{1,-2;3,4}`},
+		{`={1,-2;3,4}*2`, []int{0, 0, 1}, `-2`},
+		{`={1,-2;3,4}*2`, []int{0, 1}, `3,4`},
+		{`=SUM(B1:D5 C3:C9)`, []int{0}, `B1:D5 C3:C9`},
+		{`=SUM(B1:D5 C3:C9)`, []int{0, 1}, `C3:C9`},
+		{`=SUM(Sheet1!Age:B5)`, []int{0, 0}, `Sheet1!Age`},
+		{`=SUM(Sheet1!Age:B5)`, []int{0, 1}, `B5`},
+		{`=SUM(A1:INDEX(B1:B5, 2))`, []int{0}, `A1:INDEX(B1:B5, 2)`},
+		{`=SUM(A1:INDEX(B1:B5, 2))`, []int{0, 0}, `A1`},
+		{`=SUM(A1:INDEX(B1:B5, 2))`, []int{0, 1}, `INDEX(B1:B5, 2)`},
+		{`=SUM(A1:(B2))`, []int{0, 1}, `(B2)`},
+	}
+	for _, expectation := range expectations {
+		node := NewFormula(expectation.text).GetEntryNode()
+		for _, index := range expectation.path {
+			node = node.ChildAt(index)
+		}
+
+		span := node.Span()
+		if result := expectation.text[span.Start:span.End]; result != expectation.expected {
+			t.Errorf("%s %v Expected: %s\tActual: %s", expectation.text, expectation.path, expectation.expected, result)
+		}
+	}
+}
+
+func TestParseErrorSpan(t *testing.T) {
+	expectations := map[string]Span{
+		`=SUM(1,`: {Start: 7, End: 7},
+		`=1 + )`:  {Start: 5, End: 6},
+		`={1,A1}`: {Start: 4, End: 6},
+	}
+	for text, expected := range expectations {
+		_, err := Parse(text)
+		if parseError, ok := err.(*ParseError); !ok {
+			t.Errorf("%s Expected: *ParseError\tActual: %v", text, err)
+		} else if parseError.Span != expected {
+			t.Errorf("%s Expected: %v\tActual: %v", text, expected, parseError.Span)
+		}
+	}
+}
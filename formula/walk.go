@@ -0,0 +1,35 @@
+package formula
+
+// Visitor Callbacks of Walk. Enter is called before the children of a node,
+// returning false skips them. Leave is called after them, skipped or not
+type Visitor interface {
+	Enter(node *Node) bool
+	Leave(node *Node)
+}
+
+// Walk Visit node and the nodes under it depth first, children in order
+func Walk(node *Node, visitor Visitor) {
+	if node == nil {
+		return
+	}
+
+	if visitor.Enter(node) {
+		for _, child := range node.children {
+			Walk(child, visitor)
+		}
+	}
+	visitor.Leave(node)
+}
+
+// Inspect Walk with only an Enter callback, e.g. to collect nodes of a type
+func Inspect(node *Node, enter func(node *Node) bool) {
+	Walk(node, inspector(enter))
+}
+
+type inspector func(node *Node) bool
+
+func (enter inspector) Enter(node *Node) bool {
+	return enter(node)
+}
+
+func (enter inspector) Leave(node *Node) {}
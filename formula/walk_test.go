@@ -0,0 +1,87 @@
+package formula
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tracer Records the order Walk calls back in, skipping functions named skip
+type tracer struct {
+	skip  string
+	trace []string
+}
+
+func (v *tracer) Enter(node *Node) bool {
+	v.trace = append(v.trace, fmt.Sprintf("+%v", node.Value()))
+	return node.NodeType() != NodeTypeFunc || node.Value() != v.skip
+}
+
+func (v *tracer) Leave(node *Node) {
+	v.trace = append(v.trace, fmt.Sprintf("-%v", node.Value()))
+}
+
+func TestWalk(t *testing.T) {
+	formula := NewFormula(`=SUM(A1, 2)*ROUND(B1, 0)`)
+
+	visitor := &tracer{}
+	Walk(formula.GetEntryNode(), visitor)
+	expected := "+* +SUM +A1 -A1 +2 -2 -SUM +ROUND +B1 -B1 +0 -0 -ROUND -*"
+	if result := strings.Join(visitor.trace, " "); result != expected {
+		t.Errorf("Expected: %s\tActual: %s", expected, result)
+	}
+
+	visitor = &tracer{skip: "SUM"}
+	Walk(formula.GetEntryNode(), visitor)
+	expected = "+* +SUM -SUM +ROUND +B1 -B1 +0 -0 -ROUND -*"
+	if result := strings.Join(visitor.trace, " "); result != expected {
+		t.Errorf("Expected: %s\tActual: %s", expected, result)
+	}
+
+	Walk(nil, visitor)
+}
+
+func TestInspect(t *testing.T) {
+	formula := NewFormula(`=IF(A1>0, SUM(B1:B5), Input!C3)`)
+
+	var refs []string
+	Inspect(formula.GetEntryNode(), func(node *Node) bool {
+		if node.NodeType() == NodeTypeRef {
+			refs = append(refs, node.Value().(string))
+		}
+		return true
+	})
+	if result := strings.Join(refs, ","); result != "A1,B1:B5,Input!C3" {
+		t.Errorf("Expected: A1,B1:B5,Input!C3\tActual: %s", result)
+	}
+}
+
+func TestParentAndDepth(t *testing.T) {
+	formula := NewFormula(`=1+SUM(A1, 2*B1)`)
+	entry := formula.GetEntryNode()
+	b1 := entry.ChildAt(1).ChildAt(1).ChildAt(1)
+
+	if result := b1.Value(); result != "B1" {
+		t.Fatalf("Expected: B1\tActual: %v", result)
+	}
+	if result := b1.Parent().Value(); result != "*" {
+		t.Errorf("Expected: *\tActual: %v", result)
+	}
+	if result := entry.Parent(); result != nil {
+		t.Errorf("Expected: nil\tActual: %v", result)
+	}
+	if result := b1.Depth(); result != 3 {
+		t.Errorf("Expected: 3\tActual: %v", result)
+	}
+	if result := entry.Depth(); result != 0 {
+		t.Errorf("Expected: 0\tActual: %v", result)
+	}
+
+	var path []string
+	for _, node := range b1.PathToRoot() {
+		path = append(path, fmt.Sprintf("%v", node.Value()))
+	}
+	if result := strings.Join(path, " "); result != "B1 * SUM +" {
+		t.Errorf("Expected: B1 * SUM +\tActual: %s", result)
+	}
+}
@@ -0,0 +1,41 @@
+package funs
+
+// ExcelError Error value as displayed by MS-EXCEL, e.g. #DIV/0!
+type ExcelError string
+
+const (
+	// ErrNull Intersection of two ranges is empty
+	ErrNull ExcelError = "#NULL!"
+	// ErrDiv0 Division by zero
+	ErrDiv0 ExcelError = "#DIV/0!"
+	// ErrValue Operand or argument of the wrong type
+	ErrValue ExcelError = "#VALUE!"
+	// ErrRef Reference to a cell or sheet that does not exist
+	ErrRef ExcelError = "#REF!"
+	// ErrName Unrecognized name
+	ErrName ExcelError = "#NAME?"
+	// ErrNum Invalid numeric value
+	ErrNum ExcelError = "#NUM!"
+	// ErrNA Value is not available, e.g. no VLOOKUP match
+	ErrNA ExcelError = "#N/A"
+)
+
+var excelErrors = map[string]ExcelError{
+	string(ErrNull):  ErrNull,
+	string(ErrDiv0):  ErrDiv0,
+	string(ErrValue): ErrValue,
+	string(ErrRef):   ErrRef,
+	string(ErrName):  ErrName,
+	string(ErrNum):   ErrNum,
+	string(ErrNA):    ErrNA,
+}
+
+func (err ExcelError) Error() string {
+	return string(err)
+}
+
+// ParseExcelError Get the error value written as text, e.g. in a formula or cell
+func ParseExcelError(text string) (err ExcelError, ok bool) {
+	err, ok = excelErrors[text]
+	return
+}
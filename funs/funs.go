@@ -1,8 +1,6 @@
 package funs
 
 import (
-	"errors"
-	"fmt"
 	"math"
 	"strconv"
 	"strings"
@@ -14,6 +12,39 @@ const (
 	CompareLesser  int = -1
 )
 
+// Number Coerce an operand to a number the way MS-EXCEL arithmetic does
+// - Blank: 0
+// - TRUE/FALSE: 1/0
+// - Numeric text: its value
+// - Errors: propagated
+// - Anything else: #VALUE!
+func Number(operand interface{}) (float64, error) {
+	switch operand.(type) {
+	case float64:
+		return operand.(float64), nil
+	case int:
+		return float64(operand.(int)), nil
+	case bool:
+		if operand.(bool) {
+			return 1, nil
+		}
+		return 0, nil
+	case nil:
+		return 0, nil
+	case string:
+		if operand.(string) == "" {
+			return 0, nil
+		} else if f, err := strconv.ParseFloat(operand.(string), 64); err == nil {
+			return f, nil
+		}
+		return 0, ErrValue
+	case error:
+		return 0, operand.(error)
+	default:
+		return 0, ErrValue
+	}
+}
+
 func boolean(input interface{}) bool {
 	switch input.(type) {
 	case bool:
@@ -117,7 +148,13 @@ func SUM(input interface{}) float64 {
 		for i := 0; i < len(outer); i++ {
 			inner = outer[i]
 			for j := 0; j < len(inner); j++ {
-				sum += inner[j].(float64)
+				switch inner[j].(type) {
+				case float64:
+					sum += inner[j].(float64)
+					break
+				default:
+					break
+				}
 			}
 		}
 
@@ -127,6 +164,31 @@ func SUM(input interface{}) float64 {
 	}
 }
 
+// rangeError First error value within the given values or ranges
+func rangeError(inputs ...interface{}) error {
+	for _, input := range inputs {
+		switch input.(type) {
+		case error:
+			return input.(error)
+		case []interface{}:
+			for _, item := range input.([]interface{}) {
+				if err, ok := item.(error); ok {
+					return err
+				}
+			}
+		case [][]interface{}:
+			for _, items := range input.([][]interface{}) {
+				for _, item := range items {
+					if err, ok := item.(error); ok {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func SUM2(input1 interface{}, input2 interface{}) float64 {
 	return SUM(input1) + SUM(input2)
 }
@@ -159,6 +221,48 @@ func POWER(num interface{}, power interface{}) float64 {
 	return 0.0
 }
 
+// CONCATENATE Join values as text, the same way the & operator does
+// - Numbers are formatted as General
+// - Booleans become TRUE or FALSE
+// - Errors are propagated
+func CONCATENATE(inputs ...interface{}) interface{} {
+	var builder strings.Builder
+	for _, input := range inputs {
+		switch input.(type) {
+		case error:
+			return input
+		case string:
+			builder.WriteString(input.(string))
+		case float64:
+			builder.WriteString(general(input.(float64)))
+		case int:
+			builder.WriteString(strconv.Itoa(input.(int)))
+		case bool:
+			if input.(bool) {
+				builder.WriteString("TRUE")
+			} else {
+				builder.WriteString("FALSE")
+			}
+		case nil:
+			break
+		default:
+			return ErrValue
+		}
+	}
+	return builder.String()
+}
+
+// general Format a number the way Excel's General format displays it, to 15
+// significant digits so 0.1+0.2 shows as 0.3
+func general(input float64) string {
+	input, _ = strconv.ParseFloat(strconv.FormatFloat(input, 'g', 15, 64), 64)
+	abs := math.Abs(input)
+	if abs == 0 || (abs >= 1e-9 && abs < 1e15) {
+		return strconv.FormatFloat(input, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(input, 'E', -1, 64)
+}
+
 // MATCH
 // MATCH is an Excel function used to locate the position of a lookup value in a
 // row, column, or table. MATCH supports approximate and exact matching, and
@@ -236,7 +340,7 @@ func compare(a, b interface{}) int {
 // @see https://support.office.com/en-us/article/VLOOKUP-function-0bbc8083-26fe-4963-8ab8-93a18ad188a1
 func VLOOKUP(value interface{}, lookupRange interface{}, index int, approx bool) interface{} {
 	if index < 1 {
-		return errors.New("Index cannot be less than 1")
+		return ErrValue
 	}
 	nativeIndex := index - 1
 
@@ -253,7 +357,6 @@ func VLOOKUP(value interface{}, lookupRange interface{}, index int, approx bool)
 			referenceValue = inner[0]
 			switch referenceValue.(type) {
 			case int:
-				fmt.Printf("Reference type is int\n")
 				if approx {
 					if result, ok := value.(float64); ok && int(result) >= referenceValue.(int) {
 						return inner[nativeIndex]
@@ -291,12 +394,17 @@ func VLOOKUP(value interface{}, lookupRange interface{}, index int, approx bool)
 						return inner[nativeIndex]
 					}
 				}
+			case bool:
+				// FALSE < TRUE
+				if result, ok := value.(bool); ok && (result == referenceValue.(bool) || (approx && result)) {
+					return inner[nativeIndex]
+				}
 			}
 		}
 
-		return errors.New("N/A")
+		return ErrNA
 	default:
-		return errors.New("Lookup range must be 2D Slice")
+		return ErrNA
 	}
 }
 
@@ -26,6 +26,22 @@ func TestIFERROR(t *testing.T) {
 	if result := IFERROR(errors.New("#ERROR"), 2.2); result != 2.2 {
 		t.Errorf("Expected: 2.2\tActual:%v", result)
 	}
+
+	if result := IFERROR(ErrDiv0, 2.2); result != 2.2 {
+		t.Errorf("Expected: 2.2\tActual:%v", result)
+	}
+}
+
+func TestParseExcelError(t *testing.T) {
+	if result, ok := ParseExcelError("#DIV/0!"); !ok || result != ErrDiv0 {
+		t.Errorf("Expected: #DIV/0!\tActual:%v", result)
+	}
+	if result, ok := ParseExcelError("#N/A"); !ok || result.Error() != "#N/A" {
+		t.Errorf("Expected: #N/A\tActual:%v", result)
+	}
+	if _, ok := ParseExcelError("N/A"); ok {
+		t.Errorf("Expected: not an error value")
+	}
 }
 
 func TestFLOOR(t *testing.T) {
@@ -56,6 +72,30 @@ func TestPOWER(t *testing.T) {
 	}
 }
 
+func TestCONCATENATE(t *testing.T) {
+	if result := CONCATENATE("Plan ", 1.0); result != "Plan 1" {
+		t.Errorf("Expected: Plan 1\tActual:%v", result)
+	}
+	if result := CONCATENATE(0.1, "|", 1e20, "|", 1234567.0); result != "0.1|1E+20|1234567" {
+		t.Errorf("Expected: 0.1|1E+20|1234567\tActual:%v", result)
+	}
+	// Computed at run time, constants would be exact
+	rate, tenth := 1.1, 0.1
+	if result := CONCATENATE("Rate ", rate*3); result != "Rate 3.3" {
+		t.Errorf("Expected: Rate 3.3\tActual:%v", result)
+	}
+	if result := CONCATENATE(tenth+0.2, "", tenth/0.3); result != "0.30.333333333333333" {
+		t.Errorf("Expected: 0.30.333333333333333\tActual:%v", result)
+	}
+	if result := CONCATENATE(true, false); result != "TRUEFALSE" {
+		t.Errorf("Expected: TRUEFALSE\tActual:%v", result)
+	}
+
+	if result := CONCATENATE("Plan ", ErrNA); result != ErrNA {
+		t.Errorf("Expected: #N/A\tActual:%v", result)
+	}
+}
+
 func TestVLOOKUPfloat64(t *testing.T) {
 	var lookupRange = make([][]interface{}, 2)
 	lookupRange[0] = make([]interface{}, 1)
@@ -83,8 +123,8 @@ func TestVLOOKUPfloat64(t *testing.T) {
 		t.Errorf("Expected: 23.0\tActual:%v", result)
 	}
 
-	if result := VLOOKUP(99.0, lookupRange, 3, false); result.(error).Error() != "N/A" {
-		t.Errorf("Expected: N/A\tActual:%v", result)
+	if result := VLOOKUP(99.0, lookupRange, 3, false); result != ErrNA {
+		t.Errorf("Expected: #N/A\tActual:%v", result)
 	}
 }
 
@@ -9,9 +9,22 @@ var a1boolmap = map[string]func(interface{}) bool{
 	"AND": AND,
 }
 
-var a1float64map = map[string]func(interface{}) float64{
-	"FLOOR": FLOOR,
-	"SUM":   SUM,
+// Numeric arguments are coerced like arithmetic operands, aggregates
+// propagate errors found within their ranges
+var a1inter = map[string]func(interface{}) interface{}{
+	"FLOOR": func(p1 interface{}) interface{} {
+		number, err := Number(p1)
+		if err != nil {
+			return err
+		}
+		return FLOOR(number)
+	},
+	"SUM": func(p1 interface{}) interface{} {
+		if err := rangeError(p1); err != nil {
+			return err
+		}
+		return SUM(p1)
+	},
 }
 
 var a2boolmap = map[string]func(interface{}, interface{}) bool{
@@ -25,11 +38,7 @@ var a3boolmap = map[string]func(interface{}, interface{}, interface{}) bool{
 }
 
 var a2float64map = map[string]func(interface{}, interface{}) float64{
-	"SUM":   SUM2,
-	"POWER": POWER,
-	"ROUND": func(p1 interface{}, precision interface{}) float64 {
-		return ROUND(p1.(float64), precision.(float64))
-	},
+	"POWER":   POWER,
 	"COUNTIF": COUNTIF,
 }
 
@@ -39,14 +48,38 @@ var a2int64map = map[string]func(interface{}, interface{}) int{
 	},
 }
 
-var a3int64map = map[string]func(interface{}, interface{}, interface{}) int{
-	"MATCH": func(p1, p2 interface{}, p3 interface{}) int {
-		return MATCH(p1, p2, int(p3.(float64)))
+var a3inter = map[string]func(interface{}, interface{}, interface{}) interface{}{
+	"MATCH": func(p1, p2 interface{}, p3 interface{}) interface{} {
+		matchType, err := Number(p3)
+		if err != nil {
+			return err
+		}
+		return MATCH(p1, p2, int(matchType))
 	},
 }
 
 var a2inter = map[string]func(interface{}, interface{}) interface{}{
 	"IFERROR": IFERROR,
+	"ROUND": func(p1 interface{}, p2 interface{}) interface{} {
+		number, err := Number(p1)
+		if err != nil {
+			return err
+		}
+		precision, err := Number(p2)
+		if err != nil {
+			return err
+		}
+		return ROUND(number, precision)
+	},
+	"SUM": func(p1 interface{}, p2 interface{}) interface{} {
+		if err := rangeError(p1, p2); err != nil {
+			return err
+		}
+		return SUM2(p1, p2)
+	},
+	"CONCATENATE": func(p1 interface{}, p2 interface{}) interface{} {
+		return CONCATENATE(p1, p2)
+	},
 }
 
 var a4inter = map[string]func(interface{}, interface{}, interface{}, interface{}) interface{}{
@@ -58,10 +91,12 @@ var a4inter = map[string]func(interface{}, interface{}, interface{}, interface{}
 		} else if result, ok := p3.(float64); ok {
 			index = int(result)
 		} else {
-			return "N/A"
+			return ErrValue
 		}
 
-		if result, ok := p4.(int); ok {
+		if result, ok := p4.(bool); ok {
+			approx = result
+		} else if result, ok := p4.(int); ok {
 			approx = result == 1
 		} else if result, ok := p4.(float64); ok {
 			approx = result == 1.0
@@ -77,7 +112,7 @@ var a4inter = map[string]func(interface{}, interface{}, interface{}, interface{}
 func Exists(name string) bool {
 	if _, ok := a1boolmap[name]; ok {
 		return true
-	} else if _, ok := a1float64map[name]; ok {
+	} else if _, ok := a1inter[name]; ok {
 		return true
 	} else if _, ok := a2boolmap[name]; ok {
 		return true
@@ -85,7 +120,7 @@ func Exists(name string) bool {
 		return true
 	} else if _, ok := a3boolmap[name]; ok {
 		return true
-	} else if _, ok := a3int64map[name]; ok {
+	} else if _, ok := a3inter[name]; ok {
 		return true
 	} else if _, ok := a2float64map[name]; ok {
 		return true
@@ -102,7 +137,7 @@ func Exists(name string) bool {
 func Call1(name string, input interface{}) (ret interface{}, err error) {
 	if fn, ok := a1boolmap[name]; ok {
 		return fn(input), nil
-	} else if fn, ok := a1float64map[name]; ok {
+	} else if fn, ok := a1inter[name]; ok {
 		return fn(input), nil
 	}
 
@@ -130,7 +165,7 @@ func Call2(name string, input1 interface{}, input2 interface{}) (ret interface{}
 func Call3(name string, input1 interface{}, input2 interface{}, input3 interface{}) (ret interface{}, err error) {
 	if fn, ok := a3boolmap[name]; ok {
 		return fn(input1, input2, input3), nil
-	} else if fn, ok := a3int64map[name]; ok {
+	} else if fn, ok := a3inter[name]; ok {
 		return fn(input1, input2, input3), nil
 	}
 
@@ -26,6 +26,12 @@ func TestCall1(t *testing.T) {
 	} else if result.(float64) != 1.1 {
 		t.Errorf("Expected: 1.1\tActual: %v", result)
 	}
+
+	if result, err := Call1("SUM", []interface{}{1.1, ErrDiv0}); err != nil {
+		t.Errorf("Call1 error. %v", err)
+	} else if result != ErrDiv0 {
+		t.Errorf("Expected: #DIV/0!\tActual: %v", result)
+	}
 }
 
 func TestCall2(t *testing.T) {